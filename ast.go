@@ -1,5 +1,7 @@
 package xml
 
+import "sync/atomic"
+
 type (
 	AST interface {
 		AST()
@@ -16,6 +18,12 @@ type (
 		*Prolog
 		*Element
 		Misc []Misc
+		// the input started with a UTF-8 byte order mark, recorded by
+		// the Lossless option
+		BOM bool
+		// elements by ID, a map[string]*Element built by the first call to
+		// GetElementByID
+		ids atomic.Value
 	}
 
 	Prolog struct {
@@ -29,13 +37,39 @@ type (
 		Version    string
 		Encoding   string
 		Standalone bool
+		Span
+		// source text around the pseudo-attributes, nil when absent
+		VersionTrivia    *Trivia
+		EncodingTrivia   *Trivia
+		StandaloneTrivia *Trivia
+		// white space before '?>'
+		Space string
 	}
 
 	DOCType struct {
-		Name    string
-		ExtID   *ExternalID
+		Name  string
+		ExtID *ExternalID
+		// markup declarations and parameter-entity references in source order
 		Markups []Markup
-		PERef   *PERef
+		// declarations read from the external subset by the LoadExternal option
+		ExtSubset []Markup
+		Span
+		// source text of the whole declaration
+		Raw string
+	}
+
+	// DTD is an external subset, such as a DTD file read by ParseDTD.
+	DTD struct {
+		*TextDecl
+		// markup declarations and parameter-entity references in source order
+		Markups []Markup
+		Span
+	}
+
+	TextDecl struct {
+		Version  string
+		Encoding string
+		Span
 	}
 
 	ExternalType int
@@ -44,6 +78,7 @@ type (
 		Type   ExternalType
 		Pubid  string
 		System string
+		Span
 	}
 
 	// Markup
@@ -56,11 +91,19 @@ type (
 	ElementDecl struct {
 		Name string
 		ContentSpec
+		Span
+		// references to parameter entities replaced within the declaration
+		// or whose replacement text it was read from
+		PERefs []*PERef
 	}
 
 	Attlist struct {
 		Name string
 		Defs []*AttDef
+		Span
+		// references to parameter entities replaced within the declaration
+		// or whose replacement text it was read from
+		PERefs []*PERef
 	}
 
 	EntityType int
@@ -71,11 +114,33 @@ type (
 		Value EntityValue
 		ExtID *ExternalID
 		NData string
+		Span
+		// references to parameter entities replaced within the declaration
+		// or whose replacement text it was read from
+		PERefs []*PERef
 	}
 
 	Notation struct {
 		Name  string
 		ExtID ExternalID
+		Span
+		// references to parameter entities replaced within the declaration
+		// or whose replacement text it was read from
+		PERefs []*PERef
+	}
+
+	// CondSect is a conditional section of external markup.
+	CondSect struct {
+		// "INCLUDE" or "IGNORE", empty when given by a parameter entity
+		// that was not expanded
+		Keyword string
+		// reference the keyword is written as, if any
+		KeywordRef *PERef
+		// declarations of an INCLUDE section
+		Markups []Markup
+		// source text of the contents of a section that was not included
+		Ignored string
+		Span
 	}
 
 	// Misc
@@ -88,9 +153,21 @@ type (
 	PI struct {
 		Target      string
 		Instruction string
+		Span
+		// white space between Target and Instruction
+		Space string
 	}
 
-	Comment string
+	Comment struct {
+		Value string
+		Span
+	}
+
+	// Space is white space between markup, kept by the Lossless option.
+	Space struct {
+		Value string
+		Span
+	}
 
 	// Attribute Types
 
@@ -98,6 +175,7 @@ type (
 		Name string
 		Type AttType
 		Decl *DefaultDecl
+		Span
 	}
 
 	AttType interface {
@@ -109,10 +187,12 @@ type (
 
 	NotationType struct {
 		Names []string
+		Span
 	}
 
 	Enum struct {
 		Cases []string
+		Span
 	}
 
 	DefaultDeclType int
@@ -120,6 +200,7 @@ type (
 	DefaultDecl struct {
 		Type DefaultDeclType
 		AttValue
+		Span
 	}
 
 	// ContentSpec, ChoiceSeq
@@ -129,20 +210,27 @@ type (
 		ContentSpec()
 	}
 
-	EMPTY struct{} // EMPTY
-	ANY   struct{} // ANY
+	EMPTY struct { // EMPTY
+		Span
+	}
+	ANY struct { // ANY
+		Span
+	}
 	Mixed struct { // #PCDATA
 		Names []string
+		Span
 	}
 
 	Children struct {
 		ChoiceSeq
 		Suffix *rune // null or '?' or '*' or '+'
+		Span
 	}
 	CP struct {
 		Name string
 		ChoiceSeq
 		Suffix *rune
+		Span
 	}
 
 	ChoiceSeq interface {
@@ -151,9 +239,11 @@ type (
 	}
 	Choice struct {
 		CPs []CP // separated '|'
+		Span
 	}
 	Seq struct {
 		CPs []CP // separated ','
+		Span
 	}
 
 	// Ref
@@ -171,12 +261,15 @@ type (
 	CharRef struct {
 		Prefix string // &# or &#x
 		Value  string
+		Span
 	}
 	EntityRef struct {
 		Name string // & Name ;
+		Span
 	}
 	PERef struct {
 		Name string // % Name ;
+		Span
 	}
 
 	// Element
@@ -184,18 +277,55 @@ type (
 	Element struct {
 		Name       string
 		Attrs      Attributes
-		Contents   []interface{} // PERef, CDSect, Comment, PI, Element, String
+		Contents   []interface{} // EntityRef, CharRef, CData, Comment, PI, Element, CharData
 		IsEmptyTag bool
+		Span
+		// start-tag, or the empty-element tag
+		STag Span
+		// end-tag, zero for an empty-element tag
+		ETag Span
+		// white space before '>' or '/>' of the start-tag and before '>' of the end-tag
+		STagSpace string
+		ETagSpace string
+		// namespace name and local part of Name, set by the Namespaces option
+		NamespaceURI string
+		LocalName    string
 	}
 
 	Attribute struct {
 		Name string
 		AttValue
+		Span
+		NameSpan  Span
+		ValueSpan Span // including quotes
+		Trivia
+		// namespace name and local part of Name, set by the Namespaces option
+		NamespaceURI string
+		LocalName    string
+		// the attribute was not specified but inserted from its default
+		// value by the ApplyDefaults option
+		Defaulted bool
+	}
+
+	// Trivia is the source text of a Name="value" pair other than the name
+	// and the value, recorded by the Lossless option.
+	Trivia struct {
+		Space string // white space before the name
+		Eq    string // '=' and the white space around it
+		Quote rune   // '"' or '\''
 	}
 
 	Attributes []*Attribute
 
-	CData string
+	CData struct {
+		Value string
+		Span
+	}
+
+	CharData struct {
+		Value string
+		Span
+	}
 )
 
 // XML, Prolog, XMLDecl, DOCType and Element are Non-Terminal
@@ -203,6 +333,8 @@ func (XML) AST()             {}
 func (Prolog) AST()          {}
 func (XMLDecl) AST()         {}
 func (DOCType) AST()         {}
+func (DTD) AST()             {}
+func (TextDecl) AST()        {}
 func (ExternalType) AST()    {}
 func (ExternalID) AST()      {}
 func (ElementDecl) AST()     {}
@@ -210,8 +342,10 @@ func (Attlist) AST()         {}
 func (EntityType) AST()      {}
 func (Entity) AST()          {}
 func (Notation) AST()        {}
+func (CondSect) AST()        {}
 func (PI) AST()              {}
 func (Comment) AST()         {}
+func (Space) AST()           {}
 func (AttDef) AST()          {}
 func (AttToken) AST()        {}
 func (NotationType) AST()    {}
@@ -234,16 +368,20 @@ func (Element) AST()         {}
 func (Attribute) AST()       {}
 func (Attributes) AST()      {}
 func (CData) AST()           {}
+func (CharData) AST()        {}
 
 func (ElementDecl) Markup() {}
 func (Attlist) Markup()     {}
 func (Entity) Markup()      {}
 func (Notation) Markup()    {}
+func (PERef) Markup()       {}
+func (CondSect) Markup()    {}
 func (PI) Markup()          {}
 func (Comment) Markup()     {}
 
 func (Comment) Misc() {}
 func (PI) Misc()      {}
+func (Space) Misc()   {}
 
 func (AttToken) AttType()     {}
 func (NotationType) AttType() {}
@@ -284,4 +422,6 @@ const (
 	DefaultDeclTypeRequired
 	DefaultDeclTypeImplied
 	DefaultDeclTypeFixed
+	// a default value without #FIXED
+	DefaultDeclTypeValue
 )
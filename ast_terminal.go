@@ -5,6 +5,14 @@ import (
 	"strings"
 )
 
+func (t TextDecl) ToString() string {
+	str := "<?xml"
+	if len(t.Version) > 0 {
+		str += fmt.Sprintf(` version="%s"`, t.Version)
+	}
+	return str + fmt.Sprintf(` encoding="%s"?>`, t.Encoding)
+}
+
 func (e ExternalType) ToString() string {
 	if e == ExternalTypePublic {
 		return "PUBLIC"
@@ -56,6 +64,21 @@ func (e Entity) ToString() string {
 	return str
 }
 
+func (c CondSect) ToString() string {
+	keyword := c.Keyword
+	if c.KeywordRef != nil {
+		keyword = c.KeywordRef.ToString()
+	}
+	if c.Keyword != "INCLUDE" {
+		return fmt.Sprintf("<![%s[%s]]>", keyword, c.Ignored)
+	}
+	strs := make([]string, len(c.Markups))
+	for i, m := range c.Markups {
+		strs[i] = m.ToString()
+	}
+	return fmt.Sprintf("<![%s[%s]]>", keyword, strings.Join(strs, "\n"))
+}
+
 func (n Notation) ToString() string {
 	return fmt.Sprintf(`<!NOTATION %s %s>`, n.Name, n.ExtID.ToString())
 }
@@ -70,7 +93,11 @@ func (p PI) ToString() string {
 }
 
 func (c Comment) ToString() string {
-	return fmt.Sprintf("<!--%s-->", string(c))
+	return fmt.Sprintf("<!--%s-->", c.Value)
+}
+
+func (s Space) ToString() string {
+	return s.Value
 }
 
 func (a AttDef) ToString() string {
@@ -132,7 +159,10 @@ func (d DefaultDeclType) ToString() string {
 func (d DefaultDecl) ToString() string {
 	str := d.Type.ToString()
 	if len(d.AttValue) > 0 {
-		str += fmt.Sprintf(" %s", d.AttValue.ToString())
+		if len(str) > 0 {
+			str += " "
+		}
+		str += d.AttValue.ToString()
 	}
 	return str
 }
@@ -215,9 +245,12 @@ func (e EntityValue) ToString() string {
 func (a AttValue) ToString() string {
 	str := `"`
 	for _, v := range a {
-		if t, ok := v.(Terminal); ok {
-			str += t.ToString()
-		} else {
+		switch v := v.(type) {
+		case Terminal:
+			str += v.ToString()
+		case string:
+			str += escapeAttr(v, '"')
+		default:
 			str += fmt.Sprint(v)
 		}
 	}
@@ -250,5 +283,9 @@ func (a Attributes) ToString() string {
 }
 
 func (e CData) ToString() string {
-	return fmt.Sprintf(`<![CDATA[%s]]>`, e)
+	return fmt.Sprintf(`<![CDATA[%s]]>`, e.Value)
+}
+
+func (c CharData) ToString() string {
+	return c.Value
 }
@@ -280,6 +280,50 @@ func TestEntity_String(t *testing.T) {
 	}
 }
 
+func TestCondSect_String(t *testing.T) {
+	tests := []struct {
+		name string
+		c    CondSect
+		want string
+	}{
+		{
+			name: "include",
+			c: CondSect{
+				Keyword: "INCLUDE",
+				Markups: []Markup{
+					&ElementDecl{Name: "a", ContentSpec: &EMPTY{}},
+					&PERef{Name: "b"},
+				},
+			},
+			want: "<![INCLUDE[<!ELEMENT a EMPTY>\n%b;]]>",
+		},
+		{
+			name: "ignore",
+			c: CondSect{
+				Keyword:    "IGNORE",
+				KeywordRef: &PERef{Name: "draft"},
+				Ignored:    " <!ELEMENT a EMPTY> ",
+			},
+			want: "<![%draft;[ <!ELEMENT a EMPTY> ]]>",
+		},
+		{
+			name: "not expanded",
+			c: CondSect{
+				KeywordRef: &PERef{Name: "draft"},
+				Ignored:    "<![IGNORE[x]]>",
+			},
+			want: "<![%draft;[<![IGNORE[x]]>]]>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.c.ToString(); got != tt.want {
+				t.Errorf("CondSect.ToString() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestNotation_String(t *testing.T) {
 	type fields struct {
 		Name  string
@@ -380,7 +424,7 @@ func TestComment_String(t *testing.T) {
 		want string
 	}{
 		{
-			c:    Comment(" this is a comment "),
+			c:    Comment{Value: " this is a comment "},
 			want: `<!-- this is a comment -->`,
 		},
 	}
@@ -454,6 +498,13 @@ func TestDefaultDecl_String(t *testing.T) {
 			},
 			want: `#FIXED "a&entity;"`,
 		},
+		{
+			fields: fields{
+				Type:     DefaultDeclTypeValue,
+				AttValue: AttValue{"a"},
+			},
+			want: `"a"`,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -1094,7 +1145,7 @@ func TestCData_String(t *testing.T) {
 		want string
 	}{
 		{
-			c:    CData("cdata"),
+			c:    CData{Value: "cdata"},
 			want: `<![CDATA[cdata]]>`,
 		},
 	}
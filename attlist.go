@@ -0,0 +1,180 @@
+package xml
+
+import (
+	"strings"
+)
+
+// bindAttlist records the attribute definitions of a. The first definition
+// of an attribute is binding. Declarations following a reference to
+// a parameter entity that was not read are not processed.
+func (p *parser) bindAttlist(a *Attlist) {
+	if p.unreadPERef {
+		return
+	}
+	for _, def := range a.Defs {
+		p.attDefs.add(a.Name, def)
+	}
+}
+
+// attDefs holds attribute definitions by element and attribute name.
+type attDefs struct {
+	// definitions by element name, in declaration order
+	list  map[string][]*AttDef
+	index map[attDefKey]*AttDef
+}
+
+type attDefKey struct {
+	elem, attr string
+}
+
+func newAttDefs() attDefs {
+	return attDefs{
+		list:  map[string][]*AttDef{},
+		index: map[attDefKey]*AttDef{},
+	}
+}
+
+// add records def as a definition of an attribute of element elem unless
+// the attribute is already defined, and reports whether it did.
+func (d attDefs) add(elem string, def *AttDef) bool {
+	key := attDefKey{elem, def.Name}
+	if _, ok := d.index[key]; ok {
+		return false
+	}
+	d.index[key] = def
+	d.list[elem] = append(d.list[elem], def)
+	return true
+}
+
+// get returns the definition of the attribute attr of element elem, or nil.
+func (d attDefs) get(elem, attr string) *AttDef {
+	return d.index[attDefKey{elem, attr}]
+}
+
+// of returns the attribute definitions of element elem in declaration order.
+func (d attDefs) of(elem string) []*AttDef {
+	return d.list[elem]
+}
+
+// isTokenized reports whether t is a type other than CDATA.
+func isTokenized(t AttType) bool {
+	return t != AttTokenCDATA
+}
+
+// applyAttDefs normalises the attribute values of e according to their
+// declared types and appends the attributes e omits that have a default
+// value.
+func (p *parser) applyAttDefs(e *Element) error {
+	specified := make(map[string]bool, len(e.Attrs))
+	for _, a := range e.Attrs {
+		specified[a.Name] = true
+		def := p.attDefs.get(e.Name, a.Name)
+		a.AttValue = normalizeAttValue(a.AttValue, def != nil && isTokenized(def.Type))
+	}
+
+	for _, def := range p.attDefs.of(e.Name) {
+		if def.Decl == nil || def.Decl.Type != DefaultDeclTypeFixed && def.Decl.Type != DefaultDeclTypeValue {
+			continue
+		}
+		if specified[def.Name] {
+			continue
+		}
+		v := def.Decl.AttValue
+		if p.expandEntities {
+			var err error
+			if v, err = p.expandAttValue(v); err != nil {
+				return err
+			}
+		}
+		e.Attrs = append(e.Attrs, &Attribute{
+			Name:      def.Name,
+			AttValue:  normalizeAttValue(v, isTokenized(def.Type)),
+			Defaulted: true,
+		})
+	}
+	return nil
+}
+
+// normalizeAttValue returns v after attribute-value normalization:
+// white space characters become spaces, and character references and
+// references to predefined entities are replaced by their characters.
+// For a tokenized type, leading and trailing spaces are removed and
+// runs of spaces are replaced by a single space.
+func normalizeAttValue(v AttValue, tokenized bool) AttValue {
+	res := AttValue{}
+	// the pending run of text
+	var b strings.Builder
+	inText := false
+	flush := func() {
+		if inText {
+			res = append(res, b.String())
+			b.Reset()
+			inText = false
+		}
+	}
+	for _, c := range v {
+		switch c := c.(type) {
+		case string:
+			for _, r := range c {
+				if isSpace(r) {
+					r = ' '
+				}
+				b.WriteRune(r)
+			}
+			inText = true
+			continue
+		case *CharRef:
+			if r, err := c.Rune(); err == nil {
+				b.WriteRune(r)
+				inText = true
+				continue
+			}
+		case *EntityRef:
+			if s, ok := predefinedEntities[c.Name]; ok {
+				b.WriteString(s)
+				inText = true
+				continue
+			}
+		}
+		flush()
+		res = append(res, c)
+	}
+	flush()
+	if !tokenized {
+		return res
+	}
+
+	tokens := AttValue{}
+	for i, c := range res {
+		s, ok := c.(string)
+		if !ok {
+			tokens = append(tokens, c)
+			continue
+		}
+		s = collapseSpaces(s)
+		if i == 0 {
+			s = strings.TrimLeft(s, " ")
+		}
+		if i == len(res)-1 {
+			s = strings.TrimRight(s, " ")
+		}
+		if len(s) > 0 {
+			tokens = append(tokens, s)
+		}
+	}
+	return tokens
+}
+
+// collapseSpaces replaces runs of spaces in s by a single space.
+func collapseSpaces(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' && space {
+			continue
+		}
+		space = r == ' '
+		b.WriteRune(r)
+	}
+	return b.String()
+}
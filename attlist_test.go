@@ -0,0 +1,136 @@
+package xml
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse_ApplyDefaults(t *testing.T) {
+	const dtd = `<!DOCTYPE a [
+<!ATTLIST a
+	id ID #IMPLIED
+	kind (x | y) "x"
+	version CDATA #FIXED " 1.0 "
+	names NMTOKENS "  p   q "
+	req CDATA #REQUIRED>
+<!ENTITY e "entity">
+<!ATTLIST a ref CDATA "&e;">
+<!ATTLIST a kind CDATA "ignored">
+]>`
+	tests := []struct {
+		name    string
+		source  string
+		opts    []ParseOption
+		want    Attributes
+		wantErr bool
+	}{
+		{
+			name:   "defaults",
+			source: dtd + `<a req="r" kind="y"/>`,
+			want: Attributes{
+				{Name: "req", AttValue: AttValue{"r"}},
+				{Name: "kind", AttValue: AttValue{"y"}},
+				{Name: "version", AttValue: AttValue{" 1.0 "}, Defaulted: true},
+				{Name: "names", AttValue: AttValue{"p q"}, Defaulted: true},
+				{Name: "ref", AttValue: AttValue{&EntityRef{Name: "e"}}, Defaulted: true},
+			},
+		},
+		{
+			name:   "defaults with entities expanded",
+			source: dtd + `<a req="r" kind="y" version="1.0" names="n"/>`,
+			opts:   []ParseOption{ExpandEntities()},
+			want: Attributes{
+				{Name: "req", AttValue: AttValue{"r"}},
+				{Name: "kind", AttValue: AttValue{"y"}},
+				{Name: "version", AttValue: AttValue{"1.0"}},
+				{Name: "names", AttValue: AttValue{"n"}},
+				{Name: "ref", AttValue: AttValue{"entity"}, Defaulted: true},
+			},
+		},
+		{
+			name:   "normalised",
+			source: dtd + "<a id=\"  i1\t\" req=\" a\tb\n&#10;&lt;\" names=\" p &#32; q&#10;\" ref='' version='' other=\" o \"/>",
+			want: Attributes{
+				{Name: "id", AttValue: AttValue{"i1"}},
+				{Name: "req", AttValue: AttValue{" a b \n<"}},
+				{Name: "names", AttValue: AttValue{"p q\n"}},
+				{Name: "ref", AttValue: AttValue{}},
+				{Name: "version", AttValue: AttValue{}},
+				{Name: "other", AttValue: AttValue{" o "}},
+				{Name: "kind", AttValue: AttValue{"x"}, Defaulted: true},
+			},
+		},
+		{
+			name:   "no declarations",
+			source: `<a b="c"/>`,
+			want: Attributes{
+				{Name: "b", AttValue: AttValue{"c"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := Parse(tt.source, append(tt.opts, ApplyDefaults())...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := withoutSpans(x.Element.Attrs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Attrs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_ApplyDefaults_manyReferences(t *testing.T) {
+	const n = 300000
+	x, err := Parse(`<a x="`+strings.Repeat("\t&lt;", n)+`"/>`, ApplyDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := AttValue{strings.Repeat(" <", n)}
+	if got := x.Element.Attrs[0].AttValue; !reflect.DeepEqual(got, want) {
+		t.Errorf("AttValue is not a single run of %d characters", 2*n)
+	}
+}
+
+func TestParse_ApplyDefaults_manyAttDefs(t *testing.T) {
+	// looking up each definition among those of the element before it
+	// would take quadratic time
+	const n = 20000
+	var decl, attrs strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&decl, " a%d CDATA \"d\"", i)
+		if i%2 == 0 {
+			fmt.Fprintf(&attrs, " a%d=\"s\"", i)
+		}
+	}
+	x, err := Parse(`<!DOCTYPE e [<!ATTLIST e`+decl.String()+`>]><e`+attrs.String()+`/>`, ApplyDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(x.Element.Attrs); got != n {
+		t.Fatalf("len(Attrs) = %d, want %d", got, n)
+	}
+	if got := x.Element.Attrs[n-1]; got.Name != fmt.Sprintf("a%d", n-1) || !got.Defaulted {
+		t.Errorf("last attribute = %v, want defaulted a%d", got, n-1)
+	}
+}
+
+func TestDecoder_ApplyDefaults(t *testing.T) {
+	d := NewDecoder(strings.NewReader(`<!DOCTYPE a [<!ATTLIST b c CDATA "d">]><a><b/></a>`), ApplyDefaults())
+	for d.Next() {
+		if s, ok := d.Token().(*StartElement); ok && s.Name == "b" {
+			want := Attributes{{Name: "c", AttValue: AttValue{"d"}, Defaulted: true}}
+			if !reflect.DeepEqual(s.Attrs, want) {
+				t.Errorf("Attrs = %v, want %v", s.Attrs, want)
+			}
+			return
+		}
+	}
+	t.Fatalf("no element b: %v", d.Err())
+}
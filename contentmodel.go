@@ -0,0 +1,359 @@
+package xml
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ContentModel is a deterministic automaton of the child elements allowed
+// by a content specification. It is fed the names of the child elements one
+// at a time:
+//
+//	m := xml.CompileContentSpec(decl.ContentSpec)
+//	s := m.Start()
+//	for _, name := range names {
+//		if s, ok = m.Step(s, name); !ok {
+//			...
+//		}
+//	}
+//	if !m.Accepts(s) {
+//		...
+//	}
+//
+// The states of a model that is not deterministic are built as they are
+// reached.
+type ContentModel struct {
+	// next state of each state by element name
+	trans  []map[string]ContentState
+	accept []bool
+	// ANY allows every element
+	any bool
+	// character data is allowed, in mixed content and ANY
+	text bool
+	// sets of positions of the states, nil if the model is deterministic
+	sets *positionSets
+}
+
+// positionSets are the sets of positions of a glushkov automaton that can
+// be reached by reading the same names.
+type positionSets struct {
+	sync.Mutex
+	g     *glushkov
+	sets  [][]int
+	index map[string]ContentState
+}
+
+// ContentState is a state of a ContentModel.
+type ContentState int
+
+// CompileContentSpec returns the automaton of spec, one of EMPTY, ANY,
+// Mixed or Children.
+func CompileContentSpec(spec ContentSpec) *ContentModel {
+	m := &ContentModel{}
+	switch spec := spec.(type) {
+	case *EMPTY:
+		m.trans = []map[string]ContentState{{}}
+		m.accept = []bool{true}
+	case *ANY:
+		m.trans = []map[string]ContentState{{}}
+		m.accept = []bool{true}
+		m.any = true
+		m.text = true
+	case *Mixed:
+		trans := map[string]ContentState{}
+		for _, n := range spec.Names {
+			trans[n] = 0
+		}
+		m.trans = []map[string]ContentState{trans}
+		m.accept = []bool{true}
+		m.text = true
+	case *Children:
+		m.compile(newGlushkov(spec))
+	default:
+		panic(fmt.Sprintf("unknown content specification %T", spec))
+	}
+	return m
+}
+
+// compile builds the states of m from g. The states of a deterministic
+// model are the positions of g; those of an ambiguous one are sets of
+// positions, since a name may lead to several of them.
+func (m *ContentModel) compile(g *glushkov) {
+	if _, _, ok := g.ambiguity(); ok {
+		m.sets = &positionSets{g: g, index: map[string]ContentState{}}
+		m.addSet([]int{-1})
+		return
+	}
+	// state p+1 is entered by reading position p
+	for s := -1; s < len(g.names); s++ {
+		trans := map[string]ContentState{}
+		for _, p := range g.next(s) {
+			trans[g.names[p]] = ContentState(p + 1)
+		}
+		m.trans = append(m.trans, trans)
+		m.accept = append(m.accept, g.accepts([]int{s}))
+	}
+}
+
+// addSet adds a state for the set of positions set, whose transitions are
+// built when they are first needed.
+func (m *ContentModel) addSet(set []int) ContentState {
+	s := ContentState(len(m.sets.sets))
+	m.sets.index[fmt.Sprint(set)] = s
+	m.sets.sets = append(m.sets.sets, set)
+	m.trans = append(m.trans, nil)
+	m.accept = append(m.accept, m.sets.g.accepts(set))
+	return s
+}
+
+// transitions returns the next state of s by element name.
+func (m *ContentModel) transitions(s ContentState) map[string]ContentState {
+	if m.sets == nil {
+		return m.trans[s]
+	}
+	m.sets.Lock()
+	defer m.sets.Unlock()
+	if m.trans[s] != nil {
+		return m.trans[s]
+	}
+	g := m.sets.g
+	byName := map[string][]int{}
+	for _, q := range m.sets.sets[s] {
+		for _, p := range g.next(q) {
+			n := g.names[p]
+			if !containsInt(byName[n], p) {
+				byName[n] = append(byName[n], p)
+			}
+		}
+	}
+	trans := map[string]ContentState{}
+	for n, set := range byName {
+		sort.Ints(set)
+		next, ok := m.sets.index[fmt.Sprint(set)]
+		if !ok {
+			next = m.addSet(set)
+		}
+		trans[n] = next
+	}
+	m.trans[s] = trans
+	return trans
+}
+
+// AmbiguousContentError reports an element content model that is not
+// deterministic (XML 1.0 Appendix E): a child element may match either of
+// two particles of the same name.
+type AmbiguousContentError struct {
+	// name of the ElementDecl
+	Element string
+	// element name of the particles
+	Particle string
+	// positions of the particles
+	First  Pos
+	Second Pos
+}
+
+func (e *AmbiguousContentError) Error() string {
+	return fmt.Sprintf("content model of %q is not deterministic: %q at line %d column %d may also match at line %d column %d",
+		e.Element, e.Particle, e.First.Line, e.First.Col, e.Second.Line, e.Second.Col)
+}
+
+// CheckDeterministic returns an *AmbiguousContentError if the content model
+// of decl is not deterministic, and nil otherwise.
+func CheckDeterministic(decl *ElementDecl) error {
+	if err := ambiguousContent(decl); err != nil {
+		return err
+	}
+	return nil
+}
+
+func ambiguousContent(decl *ElementDecl) *AmbiguousContentError {
+	c, ok := decl.ContentSpec.(*Children)
+	if !ok {
+		return nil
+	}
+	g := newGlushkov(c)
+	p, q, ok := g.ambiguity()
+	if !ok {
+		return nil
+	}
+	return &AmbiguousContentError{
+		Element:  decl.Name,
+		Particle: g.names[p],
+		First:    g.spans[p].Start,
+		Second:   g.spans[q].Start,
+	}
+}
+
+// Start returns the state before the first child element.
+func (m *ContentModel) Start() ContentState {
+	return 0
+}
+
+// Step returns the state after a child element called name in state s.
+// It returns s and false if the element is not allowed there.
+func (m *ContentModel) Step(s ContentState, name string) (ContentState, bool) {
+	if m.any {
+		return s, true
+	}
+	next, ok := m.transitions(s)[name]
+	if !ok {
+		return s, false
+	}
+	return next, true
+}
+
+// Accepts reports whether the content may end in state s.
+func (m *ContentModel) Accepts(s ContentState) bool {
+	if m.sets != nil {
+		m.sets.Lock()
+		defer m.sets.Unlock()
+	}
+	return m.accept[s]
+}
+
+// Allowed returns the sorted names of the elements allowed in state s.
+// It returns nil for ANY, which allows every declared element.
+func (m *ContentModel) Allowed(s ContentState) []string {
+	var names []string
+	for n := range m.transitions(s) {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AllowsAny reports whether every element is allowed, as in ANY.
+func (m *ContentModel) AllowsAny() bool {
+	return m.any
+}
+
+// AllowsText reports whether character data is allowed, as in mixed
+// content and ANY.
+func (m *ContentModel) AllowsText() bool {
+	return m.text
+}
+
+// glushkov is the position automaton of an element content model.
+// Its states are the start state, -1, and one state per occurrence of
+// an element name in the model, the position, which is entered by
+// reading that name.
+type glushkov struct {
+	// element names and particles of the positions
+	names []string
+	spans []Span
+	// positions that may come first, and after each position
+	first  []int
+	follow [][]int
+	// positions that may come last
+	last     []bool
+	nullable bool
+}
+
+func newGlushkov(c *Children) *glushkov {
+	g := &glushkov{}
+	first, last, nullable := g.particle(CP{ChoiceSeq: c.ChoiceSeq, Suffix: c.Suffix})
+	g.first = first
+	g.nullable = nullable
+	g.last = make([]bool, len(g.names))
+	for _, p := range last {
+		g.last[p] = true
+	}
+	return g
+}
+
+// particle adds the positions of a content particle, an element name or
+// a choice or sequence, and returns its first and last positions and
+// whether it matches the empty sequence.
+func (g *glushkov) particle(cp CP) (first, last []int, nullable bool) {
+	switch v := cp.ChoiceSeq.(type) {
+	case *Choice:
+		for _, cp := range v.CPs {
+			f, l, n := g.particle(cp)
+			first = append(first, f...)
+			last = append(last, l...)
+			nullable = nullable || n
+		}
+	case *Seq:
+		nullable = true
+		for _, cp := range v.CPs {
+			f, l, n := g.particle(cp)
+			for _, p := range last {
+				g.follow[p] = append(g.follow[p], f...)
+			}
+			if nullable {
+				first = append(first, f...)
+			}
+			if n {
+				last = append(last, l...)
+			} else {
+				last = l
+			}
+			nullable = nullable && n
+		}
+	default:
+		p := len(g.names)
+		g.names = append(g.names, cp.Name)
+		g.spans = append(g.spans, cp.Span)
+		g.follow = append(g.follow, nil)
+		first, last = []int{p}, []int{p}
+	}
+
+	if suffix := cp.Suffix; suffix != nil {
+		switch *suffix {
+		case '?':
+			nullable = true
+		case '*', '+':
+			for _, p := range last {
+				g.follow[p] = append(g.follow[p], first...)
+			}
+			nullable = nullable || *suffix == '*'
+		}
+	}
+	return first, last, nullable
+}
+
+// ambiguity returns two positions with the same name that may both come
+// next in some state, or false if the automaton is deterministic.
+func (g *glushkov) ambiguity() (int, int, bool) {
+	for s := -1; s < len(g.names); s++ {
+		byName := map[string]int{}
+		for _, p := range g.next(s) {
+			if q, ok := byName[g.names[p]]; ok && q != p {
+				if q > p {
+					p, q = q, p
+				}
+				return q, p, true
+			}
+			byName[g.names[p]] = p
+		}
+	}
+	return 0, 0, false
+}
+
+// next returns the positions that may follow state s.
+func (g *glushkov) next(s int) []int {
+	if s < 0 {
+		return g.first
+	}
+	return g.follow[s]
+}
+
+// accepts reports whether the content may end in one of states.
+func (g *glushkov) accepts(states []int) bool {
+	for _, s := range states {
+		if s < 0 && g.nullable || s >= 0 && g.last[s] {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(ints []int, i int) bool {
+	for _, n := range ints {
+		if n == i {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package xml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompileContentSpec(t *testing.T) {
+	tests := []struct {
+		spec  string
+		names []string
+		want  bool
+	}{
+		{spec: `EMPTY`, names: nil, want: true},
+		{spec: `EMPTY`, names: []string{"a"}, want: false},
+		{spec: `ANY`, names: []string{"a", "b"}, want: true},
+		{spec: `(#PCDATA)`, names: []string{"a"}, want: false},
+		{spec: `(#PCDATA | a | b)*`, names: []string{"b", "a", "b"}, want: true},
+		{spec: `(#PCDATA | a | b)*`, names: []string{"c"}, want: false},
+		{spec: `(a)`, names: []string{"a"}, want: true},
+		{spec: `(a)`, names: nil, want: false},
+		{spec: `(a, b)`, names: []string{"a", "b"}, want: true},
+		{spec: `(a, b)`, names: []string{"b", "a"}, want: false},
+		{spec: `(a | b)*`, names: nil, want: true},
+		{spec: `(a | b)*`, names: []string{"b", "a", "b"}, want: true},
+		{spec: `(a, b?, c+)`, names: []string{"a", "c", "c"}, want: true},
+		{spec: `(a, b?, c+)`, names: []string{"a", "b"}, want: false},
+		{spec: `((a, b)+ | c)`, names: []string{"a", "b", "a", "b"}, want: true},
+		{spec: `((a, b)+ | c)`, names: []string{"a", "b", "c"}, want: false},
+		{spec: `(a*, a)`, names: []string{"a", "a"}, want: true},
+		{spec: `((a?)*, b)`, names: []string{"b"}, want: true},
+		{spec: `((a, b) | (a, c))`, names: []string{"a", "c"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			spec, err := newParser(tt.spec).parseContentSpec()
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := CompileContentSpec(spec)
+			s, ok := m.Start(), true
+			for _, n := range tt.names {
+				if s, ok = m.Step(s, n); !ok {
+					break
+				}
+			}
+			if got := ok && m.Accepts(s); got != tt.want {
+				t.Errorf("content %v accepted = %v, want %v", tt.names, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileContentSpec_ambiguous(t *testing.T) {
+	// the automaton of all the sets of positions has 2^n states
+	const n = 20
+	spec, err := newParser(`((a | b)*, a` + strings.Repeat(`, (a | b)`, n) + `)`).parseContentSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := CompileContentSpec(spec)
+	for _, tt := range []struct {
+		names []string
+		want  bool
+	}{
+		{names: append([]string{"b", "a"}, strings.Split(strings.Repeat("b", n), "")...), want: true},
+		{names: append([]string{"a", "b"}, strings.Split(strings.Repeat("b", n), "")...), want: false},
+		{names: strings.Split(strings.Repeat("a", n+1), ""), want: true},
+	} {
+		s, ok := m.Start(), true
+		for _, name := range tt.names {
+			if s, ok = m.Step(s, name); !ok {
+				break
+			}
+		}
+		if got := ok && m.Accepts(s); got != tt.want {
+			t.Errorf("content %v accepted = %v, want %v", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestContentModel_Allowed(t *testing.T) {
+	spec, err := newParser(`(a, (c | b)+, d?)`).parseContentSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := CompileContentSpec(spec)
+	s := m.Start()
+	if got, want := m.Allowed(s), []string{"a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Allowed() = %v, want %v", got, want)
+	}
+	s, _ = m.Step(s, "a")
+	if got, want := m.Allowed(s), []string{"b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Allowed() = %v, want %v", got, want)
+	}
+	s, _ = m.Step(s, "b")
+	if got, want := m.Allowed(s), []string{"b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Allowed() = %v, want %v", got, want)
+	}
+	if !m.Accepts(s) || m.AllowsText() || m.AllowsAny() {
+		t.Errorf("Accepts() = %v, AllowsText() = %v, AllowsAny() = %v", m.Accepts(s), m.AllowsText(), m.AllowsAny())
+	}
+}
+
+func TestCheckDeterministic(t *testing.T) {
+	tests := []struct {
+		decl string
+		want *AmbiguousContentError
+	}{
+		{decl: `<!ELEMENT x ((a, b) | (c, d))>`},
+		{decl: `<!ELEMENT x (#PCDATA | a)*>`},
+		{decl: `<!ELEMENT x (a, (b | c)*, a?)>`},
+		{decl: `<!ELEMENT x ((b, a?)+)>`},
+		{
+			decl: `<!ELEMENT x ((a, b) | (a, c))>`,
+			want: &AmbiguousContentError{
+				Element:  "x",
+				Particle: "a",
+				First:    Pos{Line: 1, Col: 15, Offset: 14},
+				Second:   Pos{Line: 1, Col: 24, Offset: 23},
+			},
+		},
+		{
+			decl: `<!ELEMENT x (a*, a)>`,
+			want: &AmbiguousContentError{
+				Element:  "x",
+				Particle: "a",
+				First:    Pos{Line: 1, Col: 14, Offset: 13},
+				Second:   Pos{Line: 1, Col: 18, Offset: 17},
+			},
+		},
+		{
+			decl: `<!ELEMENT x (a?, a)>`,
+			want: &AmbiguousContentError{
+				Element:  "x",
+				Particle: "a",
+				First:    Pos{Line: 1, Col: 14, Offset: 13},
+				Second:   Pos{Line: 1, Col: 18, Offset: 17},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.decl, func(t *testing.T) {
+			decl, err := newParser(tt.decl).parseElementDecl()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = CheckDeterministic(decl)
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("CheckDeterministic() = %v, want nil", err)
+				}
+				return
+			}
+			if !reflect.DeepEqual(err, tt.want) {
+				t.Errorf("CheckDeterministic() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package xml
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+type (
+	// Token is one of *XMLDecl, *DOCType, *StartElement, *EndElement,
+	// *CharData, *CData, *Comment, *PI, *EntityRef or *CharRef.
+	Token interface {
+		Token()
+	}
+
+	StartElement struct {
+		Name       string
+		Attrs      Attributes
+		IsEmptyTag bool
+		Span
+		// namespace name and local part of Name, set by the Namespaces option
+		NamespaceURI string
+		LocalName    string
+	}
+
+	// EndElement of an empty-element tag has the Span of the tag.
+	EndElement struct {
+		Name string
+		Span
+	}
+)
+
+func (XMLDecl) Token()      {}
+func (DOCType) Token()      {}
+func (StartElement) Token() {}
+func (EndElement) Token()   {}
+func (CharData) Token()     {}
+func (CData) Token()        {}
+func (Comment) Token()      {}
+func (PI) Token()           {}
+func (EntityRef) Token()    {}
+func (CharRef) Token()      {}
+
+type decoderState int
+
+const (
+	decodeProlog decoderState = iota
+	decodeContent
+	decodeEpilog
+	decodeEnd
+)
+
+// Decoder reads a document as a sequence of tokens. Input that has been
+// read into tokens is released, so that a large document is decoded in
+// bounded memory.
+//
+//	d := xml.NewDecoder(r)
+//	for d.Next() {
+//		tok := d.Token()
+//		...
+//	}
+//	if err := d.Err(); err != nil {
+//		...
+//	}
+type Decoder struct {
+	p     *parser
+	state decoderState
+	// names of the open elements
+	stack []string
+	// functions restoring the xml:space setting and namespaces around the open elements
+	restore []func()
+	// tokens to report before reading on: the EndElement of an empty-element
+	// tag, or the content of an expanded entity
+	queue []Token
+
+	pastDecl   bool
+	hasDOCType bool
+
+	tok Token
+	pos Pos
+	err error
+}
+
+func NewDecoder(r io.Reader, opts ...ParseOption) *Decoder {
+	p, err := newReaderParser(r, opts...)
+	return &Decoder{
+		p:   p,
+		err: err,
+	}
+}
+
+// Token returns the token read by the last call of Next.
+func (d *Decoder) Token() Token {
+	return d.tok
+}
+
+// Pos returns the position where the current token starts.
+func (d *Decoder) Pos() Pos {
+	return d.pos
+}
+
+// Err returns the first error that stopped Next, or nil at the end of the document.
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// Depth returns the number of elements open after the current token.
+func (d *Decoder) Depth() int {
+	return len(d.stack)
+}
+
+// Next reads the next token. It returns false at the end of the document
+// or when an error occurs.
+func (d *Decoder) Next() bool {
+	if d.err != nil || d.state == decodeEnd {
+		return false
+	}
+	tok, err := d.next()
+	if d.p.err != nil {
+		err = d.p.err
+	}
+	if err != nil {
+		d.err = err
+		d.tok = nil
+		d.state = decodeEnd
+		return false
+	}
+	d.tok = tok
+	return tok != nil
+}
+
+// Skip reads tokens until the element started by the current StartElement
+// has been closed. The current token becomes its EndElement.
+func (d *Decoder) Skip() error {
+	if _, ok := d.tok.(*StartElement); !ok {
+		return errors.New("current token is not a StartElement")
+	}
+	depth := len(d.stack) - 1
+	for d.Next() {
+		if _, ok := d.tok.(*EndElement); ok && len(d.stack) == depth {
+			return nil
+		}
+	}
+	if d.err != nil {
+		return d.err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+func (d *Decoder) next() (Token, error) {
+	p := d.p
+	if len(d.queue) > 0 {
+		tok := d.queue[0]
+		d.queue = d.queue[1:]
+		switch t := tok.(type) {
+		case *StartElement:
+			d.stack = append(d.stack, t.Name)
+			d.restore = append(d.restore, func() {})
+		case *EndElement:
+			d.pop()
+		}
+		return tok, nil
+	}
+	// no cursor before the next token is restored
+	p.discard()
+
+	switch d.state {
+	case decodeProlog:
+		if p.strict && isSpace(p.Get()) {
+			d.pastDecl = true
+		}
+		p.skipSpace()
+		d.pos = p.pos()
+		switch {
+		case p.Tests("<?xml") && !d.pastDecl && !d.hasDOCType:
+			d.pastDecl = true
+			return p.parseXmlDecl()
+		case p.Tests("<!DOCTYPE") && !d.hasDOCType:
+			d.pastDecl = true
+			d.hasDOCType = true
+			return p.parseDoctype()
+		case p.Tests("<!--") || p.Tests("<?"):
+			d.pastDecl = true
+			return d.nextMisc()
+		default:
+			d.state = decodeContent
+			return d.nextStartElement()
+		}
+	case decodeContent:
+		return d.nextContent()
+	case decodeEpilog:
+		defer p.setParsing("Misc")()
+		p.skipSpace()
+		d.pos = p.pos()
+		if !p.Tests("<!--") && !p.Tests("<?") {
+			// like Parse, ignore what follows the document element
+			// unless Strict
+			if !p.isEnd() && p.strict {
+				return nil, p.error(errors.New("unexpected content after the document element"))
+			}
+			d.state = decodeEnd
+			return nil, nil
+		}
+		return d.nextMisc()
+	default:
+		return nil, nil
+	}
+}
+
+// Misc ::= Comment | PI | S
+func (d *Decoder) nextMisc() (Token, error) {
+	misc, err := d.p.parseMisc()
+	if err != nil {
+		return nil, err
+	}
+	switch v := misc.(type) {
+	case *Comment:
+		return v, nil
+	case *PI:
+		return v, nil
+	default:
+		return nil, d.p.error(fmt.Errorf("unexpected misc %v", misc))
+	}
+}
+
+func (d *Decoder) nextStartElement() (Token, error) {
+	p := d.p
+	defer p.setParsing("Element")()
+
+	if p.maxDepth > 0 && len(d.stack) >= p.maxDepth {
+		return nil, p.error(ErrDepthLimit)
+	}
+	e, err := p.parseSTag()
+	if err != nil {
+		return nil, err
+	}
+	restoreNamespaces, err := p.setNamespaces(e)
+	if err != nil {
+		return nil, err
+	}
+	restoreSpace := p.setXMLSpace(e.Attrs)
+	d.stack = append(d.stack, e.Name)
+	d.restore = append(d.restore, func() {
+		restoreSpace()
+		restoreNamespaces()
+	})
+	if e.IsEmptyTag {
+		d.queue = append(d.queue, &EndElement{
+			Name: e.Name,
+			Span: e.STag,
+		})
+	}
+	return &StartElement{
+		Name:         e.Name,
+		Attrs:        e.Attrs,
+		IsEmptyTag:   e.IsEmptyTag,
+		Span:         e.STag,
+		NamespaceURI: e.NamespaceURI,
+		LocalName:    e.LocalName,
+	}, nil
+}
+
+// pop closes the innermost open element.
+func (d *Decoder) pop() {
+	d.restore[len(d.restore)-1]()
+	d.restore = d.restore[:len(d.restore)-1]
+	d.stack = d.stack[:len(d.stack)-1]
+	if len(d.stack) == 0 {
+		d.state = decodeEpilog
+	}
+}
+
+// content ::= (element | CharData | Reference | CDSect | PI | Comment)*
+func (d *Decoder) nextContent() (Token, error) {
+	p := d.p
+	name := d.stack[len(d.stack)-1]
+	defer p.setParsing(name + " tag")()
+
+	d.pos = p.pos()
+	from := p.cursor
+	for {
+		if p.cursor.index > from.index && (p.Test('<') || p.Test('&') || p.isEnd()) {
+			if text := p.text(from); p.preserveSpace || !isOnlySpaces(text) {
+				return &CharData{
+					Value: text,
+					Span:  p.span(d.pos),
+				}, nil
+			}
+			from = p.cursor
+			d.pos = p.pos()
+		}
+
+		switch {
+		case p.isEnd():
+			return nil, p.error(fmt.Errorf("expected end tag </%s>", name))
+		case p.Tests("</"):
+			start := p.pos()
+			endName, err := p.parseETag()
+			if err != nil {
+				return nil, err
+			}
+			if endName != name {
+				return nil, p.error(fmt.Errorf("EndTag name %q does not match with StartTag name %q", endName, name))
+			}
+			d.pop()
+			return &EndElement{
+				Name: endName,
+				Span: p.span(start),
+			}, nil
+		case p.Test('&'):
+			ref, err := p.parseReference()
+			if err != nil {
+				return nil, err
+			}
+			if ref, ok := ref.(*EntityRef); ok && p.expandEntities {
+				items, err := p.expandContent(ref)
+				if err != nil {
+					return nil, err
+				}
+				if !p.preserveSpace {
+					items = dropSpaces(items)
+				}
+				d.queue = appendTokens(d.queue, items)
+				return d.next()
+			}
+			return ref.(Token), nil
+		case p.Tests("<![CDATA["):
+			return p.parseCDSect()
+		case p.Tests("<!--"):
+			return p.parseComment()
+		case p.Tests("<?"):
+			return p.parsePI()
+		case p.Test('<'):
+			return d.nextStartElement()
+		case p.Tests("]]>"):
+			return nil, p.error(errors.New("unexpected ']]>' in character data"))
+		default:
+			p.Step()
+		}
+	}
+}
+
+// appendTokens appends the tokens of content items to toks.
+func appendTokens(toks []Token, items []interface{}) []Token {
+	for _, item := range items {
+		switch v := item.(type) {
+		case *Element:
+			toks = append(toks, &StartElement{
+				Name:         v.Name,
+				Attrs:        v.Attrs,
+				IsEmptyTag:   v.IsEmptyTag,
+				Span:         v.STag,
+				NamespaceURI: v.NamespaceURI,
+				LocalName:    v.LocalName,
+			})
+			toks = appendTokens(toks, v.Contents)
+			end := v.ETag
+			if v.IsEmptyTag {
+				end = v.STag
+			}
+			toks = append(toks, &EndElement{
+				Name: v.Name,
+				Span: end,
+			})
+		case Token:
+			toks = append(toks, v)
+		}
+	}
+	return toks
+}
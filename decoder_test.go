@@ -0,0 +1,209 @@
+package xml
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecoder_Next(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		want    []Token
+		pos     []Pos
+		wantErr bool
+	}{
+		{
+			name: "document",
+			source: `<?xml version="1.0"?>
+<!DOCTYPE root>
+<root a="b">
+	text&amp;<child/><![CDATA[c]]><!--d--><?e f?>
+</root>
+<!--g-->`,
+			want: []Token{
+				&XMLDecl{Version: "1.0"},
+				&DOCType{Name: "root"},
+				&StartElement{Name: "root", Attrs: Attributes{{Name: "a", AttValue: AttValue{"b"}}}},
+				&CharData{Value: "\n\ttext"},
+				&EntityRef{Name: "amp"},
+				&StartElement{Name: "child", IsEmptyTag: true},
+				&EndElement{Name: "child"},
+				&CData{Value: "c"},
+				&Comment{Value: "d"},
+				&PI{Target: "e", Instruction: "f"},
+				&EndElement{Name: "root"},
+				&Comment{Value: "g"},
+			},
+			pos: []Pos{
+				{Line: 1, Col: 1, Offset: 0},
+				{Line: 2, Col: 1, Offset: 22},
+				{Line: 3, Col: 1, Offset: 38},
+				{Line: 3, Col: 13, Offset: 50},
+				{Line: 4, Col: 6, Offset: 56},
+				{Line: 4, Col: 11, Offset: 61},
+				{Line: 4, Col: 11, Offset: 61},
+				{Line: 4, Col: 19, Offset: 69},
+				{Line: 4, Col: 32, Offset: 82},
+				{Line: 4, Col: 40, Offset: 90},
+				{Line: 5, Col: 1, Offset: 98},
+				{Line: 6, Col: 1, Offset: 106},
+			},
+		},
+		{
+			name:   "xml:space preserve",
+			source: `<root> <pre xml:space="preserve"> <a/></pre> </root>`,
+			want: []Token{
+				&StartElement{Name: "root"},
+				&StartElement{Name: "pre", Attrs: Attributes{{Name: "xml:space", AttValue: AttValue{"preserve"}}}},
+				&CharData{Value: " "},
+				&StartElement{Name: "a", IsEmptyTag: true},
+				&EndElement{Name: "a"},
+				&EndElement{Name: "pre"},
+				&EndElement{Name: "root"},
+			},
+		},
+		{
+			name:   "unclosed element",
+			source: `<root><a></a>`,
+			want: []Token{
+				&StartElement{Name: "root"},
+				&StartElement{Name: "a"},
+				&EndElement{Name: "a"},
+			},
+			wantErr: true,
+		},
+		{
+			name:   "mismatched end tag",
+			source: `<root></a>`,
+			want: []Token{
+				&StartElement{Name: "root"},
+			},
+			wantErr: true,
+		},
+		{
+			name:   "content after root element",
+			source: `<root/><!--a-->text<!--b-->`,
+			want: []Token{
+				&StartElement{Name: "root", IsEmptyTag: true},
+				&EndElement{Name: "root"},
+				&Comment{Value: "a"},
+			},
+		},
+		{
+			name:   "XML declaration after comment",
+			source: `<!--a--><?xml version="1.0"?><root/>`,
+			want: []Token{
+				&Comment{Value: "a"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDecoder(strings.NewReader(tt.source))
+			var got []Token
+			var pos []Pos
+			for d.Next() {
+				got = append(got, d.Token())
+				pos = append(pos, d.Pos())
+			}
+			if (d.Err() != nil) != tt.wantErr {
+				t.Errorf("Decoder.Err() = %v, wantErr %v", d.Err(), tt.wantErr)
+			}
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
+				t.Errorf("Decoder.Token() = %v, want %v", got, tt.want)
+			}
+			if tt.pos != nil && !reflect.DeepEqual(pos, tt.pos) {
+				t.Errorf("Decoder.Pos() = %v, want %v", pos, tt.pos)
+			}
+		})
+	}
+}
+
+func TestDecoder_Skip(t *testing.T) {
+	d := NewDecoder(strings.NewReader(`<root><skip><a>text</a><b/></skip><keep/></root>`))
+	var got []Token
+	for d.Next() {
+		tok := d.Token()
+		got = append(got, tok)
+		if s, ok := tok.(*StartElement); ok && s.Name == "skip" {
+			if err := d.Skip(); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, d.Token())
+		}
+	}
+	if d.Err() != nil {
+		t.Fatal(d.Err())
+	}
+	want := []Token{
+		&StartElement{Name: "root"},
+		&StartElement{Name: "skip"},
+		&EndElement{Name: "skip"},
+		&StartElement{Name: "keep", IsEmptyTag: true},
+		&EndElement{Name: "keep"},
+		&EndElement{Name: "root"},
+	}
+	if !reflect.DeepEqual(withoutSpans(got), want) {
+		t.Errorf("Decoder.Token() = %v, want %v", got, want)
+	}
+	if err := d.Skip(); err == nil {
+		t.Error("Decoder.Skip() should fail without StartElement")
+	}
+}
+
+// repeatReader reads head, body n times and tail.
+type repeatReader struct {
+	head, body, tail string
+	n                int
+	buf              []byte
+}
+
+func (r *repeatReader) Read(b []byte) (int, error) {
+	for len(r.buf) < len(b) && (r.n > 0 || len(r.head)+len(r.tail) > 0) {
+		switch {
+		case len(r.head) > 0:
+			r.buf, r.head = append(r.buf, r.head...), ""
+		case r.n > 0:
+			r.buf = append(r.buf, r.body...)
+			r.n--
+		default:
+			r.buf, r.tail = append(r.buf, r.tail...), ""
+		}
+	}
+	if len(r.buf) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func TestDecoder_boundedBuffer(t *testing.T) {
+	// about 8 MB
+	r := &repeatReader{
+		head: `<?xml version="1.0"?><root>`,
+		body: `<item id="1">some text &amp; more</item>`,
+		tail: `</root>`,
+		n:    200000,
+	}
+	d := NewDecoder(r)
+	items := 0
+	for d.Next() {
+		if _, ok := d.Token().(*EndElement); ok {
+			items++
+		}
+		if c := cap(d.p.source); c > 4*readSize {
+			t.Fatalf("source grew to %d bytes after %d items", c, items)
+		}
+	}
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if items != 200001 {
+		t.Errorf("read %d elements, want %d", items, 200001)
+	}
+}
@@ -0,0 +1,114 @@
+package xml
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
+	"golang.org/x/text/transform"
+)
+
+// maximum number of bytes looked at to find the encoding declaration
+const sniffLen = 1024
+
+// byte order mark of UTF-8
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// Autodetection of Character Encodings (XML 1.0 Appendix F)
+//
+// detectEncoding inspects the first bytes of the input for a byte order mark
+// or the '<?xml' pattern and returns a reader that yields the input as UTF-8,
+// and whether the input starts with a UTF-8 byte order mark.
+// When the input is in an ASCII compatible encoding without a byte order mark,
+// the encoding declared in the XML declaration is honoured.
+func (p *parser) detectEncoding(r io.Reader) (io.Reader, bool, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, false, err
+	}
+
+	var enc encoding.Encoding
+	var bom int
+	switch {
+	case bytes.HasPrefix(head, []byte{0x00, 0x00, 0xFE, 0xFF}):
+		enc, bom = utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM), 4
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE, 0x00, 0x00}):
+		enc, bom = utf32.UTF32(utf32.LittleEndian, utf32.IgnoreBOM), 4
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		enc, bom = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), 2
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		enc, bom = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), 2
+	case bytes.HasPrefix(head, utf8BOM):
+		br.Discard(len(utf8BOM))
+		return br, true, nil
+	case bytes.Equal(head, []byte{0x00, 0x00, 0x00, '<'}):
+		enc = utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM)
+	case bytes.Equal(head, []byte{'<', 0x00, 0x00, 0x00}):
+		enc = utf32.UTF32(utf32.LittleEndian, utf32.IgnoreBOM)
+	case bytes.Equal(head, []byte{0x00, '<', 0x00, '?'}):
+		enc = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	case bytes.Equal(head, []byte{'<', 0x00, '?', 0x00}):
+		enc = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	default:
+		// UTF-8 or ASCII compatible encoding named by the XML declaration
+		r, err := p.declaredEncoding(br)
+		return r, false, err
+	}
+
+	br.Discard(bom)
+	return transform.NewReader(br, enc.NewDecoder()), false, nil
+}
+
+func (p *parser) declaredEncoding(br *bufio.Reader) (io.Reader, error) {
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	charset := sniffEncoding(head)
+	if isUTF8(charset) {
+		return br, nil
+	}
+
+	if p.charsetReader != nil {
+		r, err := p.charsetReader(charset, br)
+		if err != nil {
+			return nil, newErr("XML Declaration", err, Pos{Line: 1, Col: 1})
+		}
+		return r, nil
+	}
+
+	enc, err := ianaindex.IANA.Encoding(charset)
+	if err != nil || enc == nil {
+		return nil, newErr("XML Declaration", fmt.Errorf("unsupported encoding %q", charset), Pos{Line: 1, Col: 1})
+	}
+	return transform.NewReader(br, enc.NewDecoder()), nil
+}
+
+func isUTF8(charset string) bool {
+	switch strings.ToUpper(charset) {
+	case "", "UTF-8", "UTF8", "US-ASCII", "ASCII":
+		return true
+	default:
+		return false
+	}
+}
+
+// sniffEncoding returns the encoding named by the XML declaration
+// at the start of head, or "" if there is none.
+func sniffEncoding(head []byte) string {
+	if !bytes.HasPrefix(head, []byte("<?xml")) {
+		return ""
+	}
+	x, err := newParser(string(head)).parseXmlDecl()
+	if err != nil {
+		return ""
+	}
+	return x.Encoding
+}
@@ -0,0 +1,212 @@
+package xml
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
+)
+
+func encode(t *testing.T, enc encoding.Encoding, str string) []byte {
+	b, err := enc.NewEncoder().Bytes([]byte(str))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParseReader_encoding(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  func(t *testing.T) []byte
+		opts    []ParseOption
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "UTF-8",
+			source: func(t *testing.T) []byte {
+				return []byte(`<?xml version="1.0" encoding="UTF-8"?><a>日本</a>`)
+			},
+			want: "日本",
+		},
+		{
+			name: "UTF-8 BOM",
+			source: func(t *testing.T) []byte {
+				return append([]byte{0xEF, 0xBB, 0xBF}, `<a>日本</a>`...)
+			},
+			want: "日本",
+		},
+		{
+			name: "UTF-16LE BOM",
+			source: func(t *testing.T) []byte {
+				return encode(t, unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), `<a>日本</a>`)
+			},
+			want: "日本",
+		},
+		{
+			name: "UTF-16BE BOM",
+			source: func(t *testing.T) []byte {
+				return encode(t, unicode.UTF16(unicode.BigEndian, unicode.UseBOM), `<a>日本</a>`)
+			},
+			want: "日本",
+		},
+		{
+			name: "UTF-16BE without BOM",
+			source: func(t *testing.T) []byte {
+				return encode(t, unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), `<?xml version="1.0" encoding="UTF-16"?><a>日本</a>`)
+			},
+			want: "日本",
+		},
+		{
+			name: "UTF-32LE BOM",
+			source: func(t *testing.T) []byte {
+				return encode(t, utf32.UTF32(utf32.LittleEndian, utf32.UseBOM), `<a>日本</a>`)
+			},
+			want: "日本",
+		},
+		{
+			name: "UTF-32BE without BOM",
+			source: func(t *testing.T) []byte {
+				return encode(t, utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM), `<a>日本</a>`)
+			},
+			want: "日本",
+		},
+		{
+			name: "ISO-8859-1",
+			source: func(t *testing.T) []byte {
+				return encode(t, charmap.ISO8859_1, `<?xml version="1.0" encoding="ISO-8859-1"?><a>café</a>`)
+			},
+			want: "café",
+		},
+		{
+			name: "Windows-1252",
+			source: func(t *testing.T) []byte {
+				return encode(t, charmap.Windows1252, `<?xml version="1.0" encoding='windows-1252'?><a>€</a>`)
+			},
+			want: "€",
+		},
+		{
+			name: "Shift_JIS",
+			source: func(t *testing.T) []byte {
+				return encode(t, japanese.ShiftJIS, `<?xml version="1.0" encoding="Shift_JIS"?><a>日本語</a>`)
+			},
+			want: "日本語",
+		},
+		{
+			name: "EUC-JP",
+			source: func(t *testing.T) []byte {
+				return encode(t, japanese.EUCJP, `<?xml version="1.0" encoding="EUC-JP"?><a>日本語</a>`)
+			},
+			want: "日本語",
+		},
+		{
+			name: "unsupported encoding",
+			source: func(t *testing.T) []byte {
+				return []byte(`<?xml version="1.0" encoding="x-unknown"?><a/>`)
+			},
+			wantErr: true,
+		},
+		{
+			name: "charset reader",
+			source: func(t *testing.T) []byte {
+				return []byte(`<?xml version="1.0" encoding="x-upper"?><a>abc</a>`)
+			},
+			opts: []ParseOption{
+				CharsetReader(func(charset string, input io.Reader) (io.Reader, error) {
+					if charset != "x-upper" {
+						return nil, errors.New("unexpected charset")
+					}
+					b, err := io.ReadAll(input)
+					if err != nil {
+						return nil, err
+					}
+					s := string(b)
+					return strings.NewReader(s[:strings.Index(s, ">")+1] + strings.ToUpper(s[strings.Index(s, ">")+1:])), nil
+				}),
+			},
+			want: "ABC",
+		},
+		{
+			name: "charset reader error",
+			source: func(t *testing.T) []byte {
+				return []byte(`<?xml version="1.0" encoding="ISO-8859-1"?><a/>`)
+			},
+			opts: []ParseOption{
+				CharsetReader(func(charset string, input io.Reader) (io.Reader, error) {
+					return nil, errors.New("unsupported")
+				}),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseReader(bytes.NewReader(tt.source(t)), tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseReader() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if want := []interface{}{&CharData{Value: tt.want}}; !reflect.DeepEqual(withoutSpans(got.Element.Contents), want) {
+				t.Errorf("ParseReader() contents = %v, want %v", got.Element.Contents, want)
+			}
+		})
+	}
+}
+
+func TestParseReader_offsetAfterBOM(t *testing.T) {
+	x, err := ParseReader(bytes.NewReader(append([]byte{0xEF, 0xBB, 0xBF}, "<a>\n<b/></a>"...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := x.Element.Contents[0].(*Element)
+	if want := (Pos{Line: 2, Col: 1, Offset: 7}); b.Start != want {
+		t.Errorf("Start = %v, want %v", b.Start, want)
+	}
+}
+
+func Test_sniffEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		want string
+	}{
+		{
+			name: "no declaration",
+			head: `<a/>`,
+			want: "",
+		},
+		{
+			name: "no encoding",
+			head: `<?xml version="1.0"?><a/>`,
+			want: "",
+		},
+		{
+			head: `<?xml version="1.0" encoding="EUC-JP" standalone="yes"?>`,
+			want: "EUC-JP",
+		},
+		{
+			name: "broken declaration",
+			head: `<?xml version="1.0" encoding="EUC-JP`,
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffEncoding([]byte(tt.head)); got != tt.want {
+				t.Errorf("sniffEncoding() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
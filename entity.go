@@ -0,0 +1,585 @@
+package xml
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// replacement text of the predefined entities
+var predefinedEntities = map[string]string{
+	"lt":   "<",
+	"gt":   ">",
+	"amp":  "&",
+	"apos": "'",
+	"quot": `"`,
+}
+
+// bind records the declaration of the entity e. The first declaration
+// of an entity is binding. Declarations following a reference to
+// a parameter entity that was not read are not processed.
+func (p *parser) bind(e *Entity) {
+	if p.unreadPERef {
+		return
+	}
+	entities := p.entities
+	if e.Type == EntityTypePE {
+		entities = p.paramEntities
+	}
+	if _, ok := entities[e.Name]; ok {
+		return
+	}
+	entities[e.Name] = e
+	if p.bases != nil {
+		p.bases[e] = p.baseURI
+	}
+}
+
+// entity returns the declaration of the general entity ref refers to,
+// or nil if it is not declared in the declarations that were read.
+func (p *parser) entity(ref *EntityRef) (*Entity, error) {
+	if e, ok := p.entities[ref.Name]; ok {
+		return e, nil
+	}
+	// WFC: Entity Declared
+	if p.standalone || !p.externalDecls {
+		return nil, newErr(p.parsing, fmt.Errorf("entity %q is not declared", ref.Name), ref.Start)
+	}
+	return nil, nil
+}
+
+// enter returns a parser reading text, the replacement text of the entity name.
+func (p *parser) enter(name, text string) (*parser, error) {
+	for _, n := range p.expanding {
+		if n == name {
+			// WFC: No Recursion
+			return nil, fmt.Errorf("entity %q refers to itself", name)
+		}
+	}
+	if err := p.expand(text); err != nil {
+		return nil, err
+	}
+	sub := *p
+	sub.scanner = &scanner{
+		source: []byte(text),
+	}
+	sub.expanding = append(p.expanding[:len(p.expanding):len(p.expanding)], name)
+	return &sub, nil
+}
+
+// expansion counts the replacement text read during a parse.
+type expansion struct {
+	// scanner of the document, whose source is the input read so far
+	input *scanner
+	size  int64
+}
+
+// expand counts text, a replacement text about to be parsed within the
+// entities being expanded, against the ExpansionLimits.
+func (p *parser) expand(text string) error {
+	if p.expansion == nil {
+		return nil
+	}
+	l := p.expansionLimits
+	if l.MaxDepth > 0 && len(p.expanding) >= l.MaxDepth {
+		return fmt.Errorf("%w: entities nested deeper than %d", ErrExpansionLimit, l.MaxDepth)
+	}
+	p.expansion.size += int64(len(text))
+	size := p.expansion.size
+	if l.MaxSize > 0 && size > l.MaxSize {
+		return fmt.Errorf("%w: replacement text longer than %d bytes", ErrExpansionLimit, l.MaxSize)
+	}
+	input := float64(p.expansion.input.size())
+	if l.MaxRatio > 0 && size > 1<<20 && float64(size) > l.MaxRatio*input {
+		return fmt.Errorf("%w: replacement text more than %g times longer than the input", ErrExpansionLimit, l.MaxRatio)
+	}
+	return nil
+}
+
+// enterEntity returns a parser reading the replacement text of e,
+// referred to by name, loading it when e is external.
+func (p *parser) enterEntity(name string, e *Entity) (*parser, error) {
+	base := p.bases[e]
+	var text string
+	var err error
+	if e.ExtID != nil {
+		text, base, err = p.open(name, e.ExtID, base)
+	} else {
+		text, err = replacementText(e.Value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sub, err := p.enter(name, text)
+	if err != nil {
+		return nil, err
+	}
+	sub.baseURI = base
+	if e.ExtID != nil {
+		sub.external = true
+	}
+	return sub, nil
+}
+
+// entityError reports err found in the replacement text of the entity
+// referred to by name at start.
+func (p *parser) entityError(name string, start Pos, err error) error {
+	return newErr(p.parsing, fmt.Errorf("in entity %q: %w", name, err), start)
+}
+
+// expandContent parses the replacement text of the entity ref refers to
+// as content. The reference itself is returned when its replacement text
+// is not available.
+func (p *parser) expandContent(ref *EntityRef) ([]interface{}, error) {
+	if v, ok := predefinedEntities[ref.Name]; ok {
+		return []interface{}{&CharData{Value: v, Span: ref.Span}}, nil
+	}
+	e, err := p.entity(ref)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return []interface{}{ref}, nil
+	}
+	if len(e.NData) > 0 {
+		// WFC: Parsed Entity
+		return nil, newErr(p.parsing, fmt.Errorf("reference to unparsed entity %q", ref.Name), ref.Start)
+	}
+	if e.ExtID != nil && p.resolver == nil {
+		return []interface{}{ref}, nil
+	}
+
+	sub, err := p.enterEntity(ref.Name, e)
+	if err != nil {
+		return nil, p.entityError(ref.Name, ref.Start, err)
+	}
+	items := sub.parseContent()
+	if sub.err == nil && !sub.isEnd() {
+		sub.err = sub.error(errors.New("replacement text is not well-formed content"))
+	}
+	if sub.err != nil {
+		return nil, p.entityError(ref.Name, ref.Start, sub.err)
+	}
+	moveSpans(items, ref.Span)
+	return items, nil
+}
+
+// moveSpans gives items read from a replacement text, and everything in
+// them, the position span of the reference to the entity.
+func moveSpans(items []interface{}, span Span) {
+	for _, item := range items {
+		switch v := item.(type) {
+		case *Element:
+			v.Span = span
+			v.STag = span
+			if !v.IsEmptyTag {
+				v.ETag = span
+			}
+			for _, a := range v.Attrs {
+				a.Span = span
+				a.NameSpan = span
+				a.ValueSpan = span
+			}
+			moveSpans(v.Contents, span)
+		case *CharData:
+			v.Span = span
+		case *CData:
+			v.Span = span
+		case *Comment:
+			v.Span = span
+		case *PI:
+			v.Span = span
+		case *CharRef:
+			v.Span = span
+		case *EntityRef:
+			v.Span = span
+		case *PERef:
+			v.Span = span
+		}
+	}
+}
+
+// moveDeclSpans gives markups read from a replacement text, and everything
+// in them, the position span of the reference to the parameter entity.
+func moveDeclSpans(markups []Markup, span Span) {
+	for _, m := range markups {
+		switch m := m.(type) {
+		case *ElementDecl:
+			m.Span = span
+			moveContentSpecSpans(m.ContentSpec, span)
+			movePERefSpans(m.PERefs, span)
+		case *Attlist:
+			m.Span = span
+			for _, def := range m.Defs {
+				def.Span = span
+				switch t := def.Type.(type) {
+				case *Enum:
+					t.Span = span
+				case *NotationType:
+					t.Span = span
+				}
+				if def.Decl != nil {
+					def.Decl.Span = span
+					moveSpans(def.Decl.AttValue, span)
+				}
+			}
+			movePERefSpans(m.PERefs, span)
+		case *Entity:
+			m.Span = span
+			moveSpans(m.Value, span)
+			if m.ExtID != nil {
+				m.ExtID.Span = span
+			}
+			movePERefSpans(m.PERefs, span)
+		case *Notation:
+			m.Span = span
+			m.ExtID.Span = span
+			movePERefSpans(m.PERefs, span)
+		case *PI:
+			m.Span = span
+		case *Comment:
+			m.Span = span
+		case *PERef:
+			m.Span = span
+		case *CondSect:
+			m.Span = span
+			if m.KeywordRef != nil {
+				m.KeywordRef.Span = span
+			}
+			moveDeclSpans(m.Markups, span)
+		}
+	}
+}
+
+func moveContentSpecSpans(c ContentSpec, span Span) {
+	switch c := c.(type) {
+	case *EMPTY:
+		c.Span = span
+	case *ANY:
+		c.Span = span
+	case *Mixed:
+		c.Span = span
+	case *Children:
+		c.Span = span
+		moveChoiceSeqSpans(c.ChoiceSeq, span)
+	}
+}
+
+func moveChoiceSeqSpans(c ChoiceSeq, span Span) {
+	var cps []CP
+	switch c := c.(type) {
+	case *Choice:
+		c.Span = span
+		cps = c.CPs
+	case *Seq:
+		c.Span = span
+		cps = c.CPs
+	}
+	for i := range cps {
+		cps[i].Span = span
+		moveChoiceSeqSpans(cps[i].ChoiceSeq, span)
+	}
+}
+
+func movePERefSpans(refs []*PERef, span Span) {
+	for _, ref := range refs {
+		ref.Span = span
+	}
+}
+
+// expandAttValue replaces the references to general entities in v by their
+// replacement text.
+func (p *parser) expandAttValue(v AttValue) (AttValue, error) {
+	res := AttValue{}
+	for _, c := range v {
+		ref, ok := c.(*EntityRef)
+		if !ok {
+			res = append(res, c)
+			continue
+		}
+		if v, ok := predefinedEntities[ref.Name]; ok {
+			res = append(res, v)
+			continue
+		}
+		e, err := p.entity(ref)
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			res = append(res, ref)
+			continue
+		}
+		if e.ExtID != nil {
+			// WFC: No External Entity References
+			return nil, newErr(p.parsing, fmt.Errorf("reference to external entity %q in attribute value", ref.Name), ref.Start)
+		}
+
+		text, err := replacementText(e.Value)
+		if err != nil {
+			return nil, p.entityError(ref.Name, ref.Start, err)
+		}
+		sub, err := p.enter(ref.Name, text)
+		if err != nil {
+			return nil, p.entityError(ref.Name, ref.Start, err)
+		}
+		// WFC: No < in Attribute Values
+		items, err := sub.parseAttChars(0)
+		if err == nil {
+			items, err = sub.expandAttValue(items)
+		}
+		if err != nil {
+			return nil, p.entityError(ref.Name, ref.Start, err)
+		}
+		res = append(res, items...)
+	}
+	return joinAttValue(res), nil
+}
+
+// expandPERef appends the declarations in the replacement text of the
+// parameter entity ref refers to to markups. The reference itself is
+// appended when its replacement text is not available.
+func (p *parser) expandPERef(ref *PERef, markups []Markup) ([]Markup, error) {
+	e, ok := p.paramEntities[ref.Name]
+	if !ok {
+		// WFC: Entity Declared
+		if p.standalone {
+			return nil, newErr(p.parsing, fmt.Errorf("parameter entity %q is not declared", ref.Name), ref.Start)
+		}
+		p.unreadPERef = true
+		return append(markups, ref), nil
+	}
+	if e.ExtID != nil && p.resolver == nil {
+		p.unreadPERef = true
+		return append(markups, ref), nil
+	}
+
+	name := "%" + ref.Name
+	n := len(markups)
+	sub, err := p.enterEntity(name, e)
+	if err == nil {
+		markups, err = sub.parseDecls(markups)
+	}
+	if err != nil {
+		return nil, p.entityError(name, ref.Start, err)
+	}
+	p.unreadPERef = sub.unreadPERef
+	moveDeclSpans(markups[n:], ref.Span)
+	readFrom(markups[n:], ref)
+	return markups, nil
+}
+
+// readFrom records ref in the declarations read from its replacement text.
+func readFrom(markups []Markup, ref *PERef) {
+	for _, m := range markups {
+		switch m := m.(type) {
+		case *ElementDecl:
+			m.PERefs = append(m.PERefs, ref)
+		case *Attlist:
+			m.PERefs = append(m.PERefs, ref)
+		case *Entity:
+			m.PERefs = append(m.PERefs, ref)
+		case *Notation:
+			m.PERefs = append(m.PERefs, ref)
+		case *CondSect:
+			readFrom(m.Markups, ref)
+		}
+	}
+}
+
+// expandDeclPERefs replaces the references to parameter entities outside
+// literals in text, the source of a markup declaration in external markup
+// starting at at, by their replacement text padded with spaces. It returns
+// the references replaced.
+func (p *parser) expandDeclPERefs(text string, at cursor) (string, []*PERef, error) {
+	sc := *p
+	sc.scanner = &scanner{
+		source: []byte(text),
+		base:   at.index,
+		cursor: at,
+	}
+	var b strings.Builder
+	var quote rune
+	var refs []*PERef
+	from := sc.cursor
+	for !sc.isEnd() {
+		r := sc.Get()
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '%' && sc.atPERef():
+			b.WriteString(sc.text(from))
+			ref, err := sc.parsePERef()
+			if err != nil {
+				return "", nil, err
+			}
+			repl, err := p.declPERefText(ref)
+			if err != nil {
+				return "", nil, err
+			}
+			b.WriteString(" " + repl + " ")
+			refs = append(refs, ref)
+			from = sc.cursor
+			continue
+		}
+		sc.Step()
+	}
+	b.WriteString(sc.text(from))
+	return b.String(), refs, nil
+}
+
+// atPERef reports whether the cursor is at a reference to a parameter
+// entity rather than at the '%' of a parameter entity declaration.
+func (p *parser) atPERef() bool {
+	cur := p.cursor
+	p.Step()
+	ok := isLetter(p.Get()) || p.Test('_') || p.Test(':')
+	p.cursor = cur
+	return ok
+}
+
+// declPERefText returns the replacement text of the parameter entity ref
+// refers to within a markup declaration, with the references in it replaced.
+func (p *parser) declPERefText(ref *PERef) (string, error) {
+	name := "%" + ref.Name
+	e, ok := p.paramEntities[ref.Name]
+	if !ok {
+		return "", newErr(p.parsing, fmt.Errorf("parameter entity %q is not declared", ref.Name), ref.Start)
+	}
+	if e.ExtID != nil && p.resolver == nil {
+		return "", newErr(p.parsing, fmt.Errorf("parameter entity %q is external", ref.Name), ref.Start)
+	}
+	sub, err := p.enterEntity(name, e)
+	if err != nil {
+		return "", p.entityError(name, ref.Start, err)
+	}
+	text, _, err := sub.expandDeclPERefs(string(sub.source), sub.cursor)
+	if err != nil {
+		return "", p.entityError(name, ref.Start, err)
+	}
+	return text, nil
+}
+
+// includePERefs returns v, an entity value in external markup, with the
+// references to parameter entities in it replaced by their replacement
+// text, in which references to parameter entities are included as well.
+// It returns the references replaced in v.
+func (p *parser) includePERefs(v EntityValue) (EntityValue, []*PERef, error) {
+	res := EntityValue{}
+	var refs []*PERef
+	for _, c := range v {
+		ref, ok := c.(*PERef)
+		if !ok {
+			res = append(res, c)
+			continue
+		}
+		name := "%" + ref.Name
+		e, ok := p.paramEntities[ref.Name]
+		if !ok {
+			return nil, nil, newErr(p.parsing, fmt.Errorf("parameter entity %q is not declared", ref.Name), ref.Start)
+		}
+		if e.ExtID != nil && p.resolver == nil {
+			return nil, nil, newErr(p.parsing, fmt.Errorf("parameter entity %q is external", ref.Name), ref.Start)
+		}
+		sub, err := p.enterEntity(name, e)
+		if err != nil {
+			return nil, nil, p.entityError(name, ref.Start, err)
+		}
+		items, err := sub.parseEntityChars(0)
+		if err == nil {
+			items, _, err = sub.includePERefs(items)
+		}
+		if err != nil {
+			return nil, nil, p.entityError(name, ref.Start, err)
+		}
+		moveSpans(items, ref.Span)
+		res = append(res, items...)
+		refs = append(refs, ref)
+	}
+	return res, refs, nil
+}
+
+// replacementText returns the replacement text of an internal entity:
+// its literal value with character references replaced and other
+// references left as they are.
+func replacementText(v EntityValue) (string, error) {
+	var b strings.Builder
+	for _, c := range v {
+		switch c := c.(type) {
+		case string:
+			b.WriteString(c)
+		case *CharRef:
+			r, err := c.Rune()
+			if err != nil {
+				return "", err
+			}
+			b.WriteRune(r)
+		case Terminal:
+			b.WriteString(c.ToString())
+		}
+	}
+	return b.String(), nil
+}
+
+// joinContent joins each run of adjacent character data in contents,
+// reusing its storage.
+func joinContent(contents []interface{}) []interface{} {
+	res := contents[:0]
+	for i := 0; i < len(contents); {
+		j := i
+		for j < len(contents) {
+			if _, ok := contents[j].(*CharData); !ok {
+				break
+			}
+			j++
+		}
+		if j-i < 2 {
+			res = append(res, contents[i])
+			i++
+			continue
+		}
+		var b strings.Builder
+		for _, c := range contents[i:j] {
+			b.WriteString(c.(*CharData).Value)
+		}
+		res = append(res, &CharData{
+			Value: b.String(),
+			Span: Span{
+				Start: contents[i].(*CharData).Start,
+				End:   contents[j-1].(*CharData).End,
+			},
+		})
+		i = j
+	}
+	return res
+}
+
+// joinAttValue joins each run of adjacent strings in v, reusing its
+// storage.
+func joinAttValue(v AttValue) AttValue {
+	res := v[:0]
+	for i := 0; i < len(v); {
+		j := i
+		for j < len(v) {
+			if _, ok := v[j].(string); !ok {
+				break
+			}
+			j++
+		}
+		if j-i < 2 {
+			res = append(res, v[i])
+			i++
+			continue
+		}
+		var b strings.Builder
+		for _, s := range v[i:j] {
+			b.WriteString(s.(string))
+		}
+		res = append(res, b.String())
+		i = j
+	}
+	return res
+}
@@ -0,0 +1,404 @@
+package xml
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse_ExpandEntities(t *testing.T) {
+	const dtd = `<!DOCTYPE a [
+	<!ENTITY markup "<b>bold</b> &amp; text">
+	<!ENTITY outer "one &inner;">
+	<!ENTITY inner "two">
+	<!ENTITY lt2 "&#60;c/>">
+	<!ENTITY self "x &self;">
+	<!ENTITY ext SYSTEM "ext.xml">
+	<!ENTITY unparsed SYSTEM "img.gif" NDATA gif>
+	<!ENTITY tag "<">
+]>`
+	tests := []struct {
+		name     string
+		source   string
+		opts     []ParseOption
+		contents []interface{}
+		attrs    Attributes
+		wantErr  bool
+	}{
+		{
+			name:   "predefined",
+			source: `<a x="&quot;&apos;">x &amp; &lt;y&gt;</a>`,
+			contents: []interface{}{
+				&CharData{Value: "x & <y>"},
+			},
+			attrs: Attributes{{Name: "x", AttValue: AttValue{`"'`}}},
+		},
+		{
+			name:   "markup",
+			source: dtd + `<a>pre &markup; post</a>`,
+			contents: []interface{}{
+				&CharData{Value: "pre "},
+				&Element{Name: "b", Contents: []interface{}{&CharData{Value: "bold"}}},
+				&CharData{Value: " & text post"},
+			},
+		},
+		{
+			name:   "nested",
+			source: dtd + `<a x="&outer;">&outer;</a>`,
+			contents: []interface{}{
+				&CharData{Value: "one two"},
+			},
+			attrs: Attributes{{Name: "x", AttValue: AttValue{"one two"}}},
+		},
+		{
+			name:   "character reference in entity value",
+			source: dtd + `<a>&lt2;</a>`,
+			contents: []interface{}{
+				&Element{Name: "c", IsEmptyTag: true},
+			},
+		},
+		{
+			name:   "external entity",
+			source: dtd + `<a>&ext;</a>`,
+			contents: []interface{}{
+				&EntityRef{Name: "ext"},
+			},
+		},
+		{
+			name:   "undeclared with external subset",
+			source: `<!DOCTYPE a SYSTEM "a.dtd"><a>&undeclared;</a>`,
+			contents: []interface{}{
+				&EntityRef{Name: "undeclared"},
+			},
+		},
+		{
+			name:    "undeclared",
+			source:  `<a>&undeclared;</a>`,
+			wantErr: true,
+		},
+		{
+			name:    "undeclared in attribute value",
+			source:  `<a x="&undeclared;"/>`,
+			wantErr: true,
+		},
+		{
+			name:    "undeclared in standalone document",
+			source:  `<?xml version="1.0" standalone="yes"?><!DOCTYPE a SYSTEM "a.dtd"><a>&undeclared;</a>`,
+			wantErr: true,
+		},
+		{
+			name:    "recursion",
+			source:  dtd + `<a>&self;</a>`,
+			wantErr: true,
+		},
+		{
+			name:    "unparsed entity",
+			source:  dtd + `<a>&unparsed;</a>`,
+			wantErr: true,
+		},
+		{
+			name:    "external entity in attribute value",
+			source:  dtd + `<a x="&ext;"/>`,
+			wantErr: true,
+		},
+		{
+			name:    "< in attribute value",
+			source:  dtd + `<a x="&tag;"/>`,
+			wantErr: true,
+		},
+		{
+			name:    "not well-formed replacement text",
+			source:  dtd + `<a>&tag;</a>`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := Parse(tt.source, ExpandEntities())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := withoutSpans(x.Element.Contents); !reflect.DeepEqual(got, tt.contents) {
+				t.Errorf("Contents = %v, want %v", got, tt.contents)
+			}
+			if got := withoutSpans(x.Element.Attrs); tt.attrs != nil && !reflect.DeepEqual(got, tt.attrs) {
+				t.Errorf("Attrs = %v, want %v", got, tt.attrs)
+			}
+		})
+	}
+}
+
+func TestParse_entityRefsKept(t *testing.T) {
+	x, err := Parse(`<a>&amp;&undeclared;</a>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{&EntityRef{Name: "amp"}, &EntityRef{Name: "undeclared"}}
+	if got := withoutSpans(x.Element.Contents); !reflect.DeepEqual(got, want) {
+		t.Errorf("Contents = %v, want %v", got, want)
+	}
+}
+
+func TestParse_manyReferences(t *testing.T) {
+	// joining each expansion onto the text before it would take
+	// quadratic time
+	const n = 300000
+	refs := strings.Repeat("&lt;", n)
+	x, err := Parse(`<a x="`+refs+`">`+refs+`</a>`, ExpandEntities())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Repeat("<", n)
+	if len(x.Element.Contents) != 1 || x.Element.Contents[0].(*CharData).Value != want {
+		t.Errorf("Contents is not a single run of %d characters", n)
+	}
+	if got := x.Element.Attrs[0].AttValue; len(got) != 1 || got[0] != want {
+		t.Errorf("AttValue is not a single run of %d characters", n)
+	}
+}
+
+func TestParse_expandedSpans(t *testing.T) {
+	const doc = `<!DOCTYPE a [<!ENTITY e "<b c='d'>x</b>">]><a>&e;</a>`
+	x, err := Parse(doc, ExpandEntities())
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := uint(strings.Index(doc, "&e;"))
+	ref := Span{
+		Start: Pos{Line: 1, Col: at + 1, Offset: at},
+		End:   Pos{Line: 1, Col: at + 4, Offset: at + 3},
+	}
+	b := x.Element.Contents[0].(*Element)
+	for name, got := range map[string]Span{
+		"Element":   b.Span,
+		"STag":      b.STag,
+		"ETag":      b.ETag,
+		"Attribute": b.Attrs[0].Span,
+		"CharData":  b.Contents[0].(*CharData).Span,
+	} {
+		if got != ref {
+			t.Errorf("%s = %v, want %v", name, got, ref)
+		}
+	}
+}
+
+func TestDecoder_ExpandEntities(t *testing.T) {
+	d := NewDecoder(strings.NewReader(`<!DOCTYPE a [<!ENTITY e "x <b>y</b> ">]><a>&e;&amp;</a>`), ExpandEntities())
+	var got []Token
+	for d.Next() {
+		got = append(got, d.Token())
+	}
+	if d.Err() != nil {
+		t.Fatal(d.Err())
+	}
+	want := []Token{
+		&DOCType{Name: "a", Markups: []Markup{&Entity{Name: "e", Value: EntityValue{"x <b>y</b> "}}}},
+		&StartElement{Name: "a"},
+		&CharData{Value: "x "},
+		&StartElement{Name: "b"},
+		&CharData{Value: "y"},
+		&EndElement{Name: "b"},
+		&CharData{Value: "&"},
+		&EndElement{Name: "a"},
+	}
+	if !reflect.DeepEqual(withoutSpans(got), want) {
+		t.Errorf("Decoder.Token() = %v, want %v", got, want)
+	}
+}
+
+func TestParse_ExpandParameterEntities(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		opts    []ParseOption
+		want    []Markup
+		wantErr bool
+	}{
+		{
+			name: "kept in order",
+			source: `<!DOCTYPE a [
+	%one;
+	<!ELEMENT a ANY>
+	%two;
+]><a/>`,
+			want: []Markup{
+				&PERef{Name: "one"},
+				&ElementDecl{Name: "a", ContentSpec: &ANY{}},
+				&PERef{Name: "two"},
+			},
+		},
+		{
+			name: "expanded",
+			source: `<!DOCTYPE a [
+	<!ENTITY % decls "<!ELEMENT a ANY> %inner;">
+	<!ENTITY % inner "<!ENTITY e 'x'>">
+	%decls;
+]><a/>`,
+			opts: []ParseOption{ExpandParameterEntities()},
+			want: []Markup{
+				&Entity{Name: "decls", Type: EntityTypePE, Value: EntityValue{"<!ELEMENT a ANY> ", &PERef{Name: "inner"}}},
+				&Entity{Name: "inner", Type: EntityTypePE, Value: EntityValue{"<!ENTITY e 'x'>"}},
+				&ElementDecl{Name: "a", ContentSpec: &ANY{}, PERefs: []*PERef{{Name: "decls"}}},
+				&Entity{Name: "e", Type: EntityTypeGE, Value: EntityValue{"x"}, PERefs: []*PERef{{Name: "inner"}, {Name: "decls"}}},
+			},
+		},
+		{
+			name: "external and undeclared kept",
+			source: `<!DOCTYPE a [
+	<!ENTITY % ext SYSTEM "ext.dtd">
+	%ext;
+	%undeclared;
+]><a/>`,
+			opts: []ParseOption{ExpandParameterEntities()},
+			want: []Markup{
+				&Entity{Name: "ext", Type: EntityTypePE, ExtID: &ExternalID{Type: ExternalTypeSystem, System: "ext.dtd"}},
+				&PERef{Name: "ext"},
+				&PERef{Name: "undeclared"},
+			},
+		},
+		{
+			name:    "undeclared in standalone document",
+			source:  `<?xml version="1.0" standalone="yes"?><!DOCTYPE a [%undeclared;]><a/>`,
+			opts:    []ParseOption{ExpandParameterEntities()},
+			wantErr: true,
+		},
+		{
+			name:    "recursion",
+			source:  `<!DOCTYPE a [<!ENTITY % r "%r;"> %r;]><a/>`,
+			opts:    []ParseOption{ExpandParameterEntities()},
+			wantErr: true,
+		},
+		{
+			name:    "not markup declarations",
+			source:  `<!DOCTYPE a [<!ENTITY % p "<!ELEMENT a ANY"> %p;]><a/>`,
+			opts:    []ParseOption{ExpandParameterEntities()},
+			wantErr: true,
+		},
+		{
+			name:    "partial declaration",
+			source:  `<!DOCTYPE a [<!ENTITY % p "<!ELEMENT a ANY> ]"> %p;]><a/>`,
+			opts:    []ParseOption{ExpandParameterEntities()},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := Parse(tt.source, tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := withoutSpans(x.Prolog.DOCType.Markups); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Markups = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_PERefsInEntityValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		dtd      string
+		contents []interface{}
+		wantErr  bool
+	}{
+		{
+			name: "included",
+			dtd:  `<!ENTITY % p "text"><!ENTITY b "[%p;]">`,
+			contents: []interface{}{
+				&CharData{Value: "[text]"},
+			},
+		},
+		{
+			name: "nested",
+			dtd:  `<!ENTITY % q "x"><!ENTITY % p "%q;y"><!ENTITY b "[%p;]">`,
+			contents: []interface{}{
+				&CharData{Value: "[xy]"},
+			},
+		},
+		{
+			name: "markup in replacement text",
+			dtd:  `<!ENTITY % p "&#60;c/>"><!ENTITY b "%p;">`,
+			contents: []interface{}{
+				&Element{Name: "c", IsEmptyTag: true},
+			},
+		},
+		{
+			name:    "undeclared",
+			dtd:     `<!ENTITY b "[%p;]">`,
+			wantErr: true,
+		},
+		{
+			name:    "reference to itself",
+			dtd:     `<!ENTITY % p "%p;"><!ENTITY b "%p;">`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := Parse(`<!DOCTYPE a SYSTEM "a.dtd"><a>&b;</a>`,
+				Resolver(MapResolver{"a.dtd": tt.dtd}), ExternalPolicy(AllowSchemes{"file"}), ExpandEntities())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := withoutSpans(x.Element.Contents); !reflect.DeepEqual(got, tt.contents) {
+				t.Errorf("Contents = %v, want %v", got, tt.contents)
+			}
+		})
+	}
+}
+
+func TestParse_declarationsAfterPERef(t *testing.T) {
+	// e may be declared differently in the entity that was not read
+	x, err := Parse(`<!DOCTYPE a [%p; <!ENTITY e "x">]><a>&e;</a>`, ExpandEntities())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{&EntityRef{Name: "e"}}
+	if got := withoutSpans(x.Element.Contents); !reflect.DeepEqual(got, want) {
+		t.Errorf("Contents = %v, want %v", got, want)
+	}
+}
+
+func TestParse_declarationsAfterNestedPERef(t *testing.T) {
+	// p is not declared, so the declarations after the reference to q
+	// are not processed either
+	x, err := Parse(`<!DOCTYPE a [<!ENTITY % q "%p;"> %q; <!ENTITY e "x">]><a>&e;</a>`,
+		ExpandParameterEntities(), ExpandEntities())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{&EntityRef{Name: "e"}}
+	if got := withoutSpans(x.Element.Contents); !reflect.DeepEqual(got, want) {
+		t.Errorf("Contents = %v, want %v", got, want)
+	}
+}
+
+func TestParse_manyEntityDecls(t *testing.T) {
+	// looking for a reference to a parameter entity in the declarations
+	// before each one would take quadratic time
+	const n = 40000
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE a [")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, `<!ENTITY e%d "x">`, i)
+	}
+	fmt.Fprintf(&b, "]><a>&e%d;</a>", n-1)
+	x, err := Parse(b.String(), ExpandEntities())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{&CharData{Value: "x"}}
+	if got := withoutSpans(x.Element.Contents); !reflect.DeepEqual(got, want) {
+		t.Errorf("Contents = %v, want %v", got, want)
+	}
+}
@@ -1,9 +1,20 @@
 package xml
 
 import (
+	"errors"
 	"fmt"
 )
 
+var (
+	// ErrSizeLimit is returned when the input is longer than allowed by MaxSize.
+	ErrSizeLimit = errors.New("document exceeds size limit")
+	// ErrDepthLimit is reported when elements nest deeper than allowed by MaxDepth.
+	ErrDepthLimit = errors.New("elements nested too deeply")
+	// ErrExpansionLimit is reported when expanding entities exceeds
+	// the ExpansionLimits of the parse.
+	ErrExpansionLimit = errors.New("entity expansion exceeds limit")
+)
+
 type XMLError struct {
 	Parsing string
 	Err     error
@@ -25,3 +36,31 @@ func (e *XMLError) Error() string {
 	}
 	return str
 }
+
+func (e *XMLError) Unwrap() error {
+	return e.Err
+}
+
+// ValidityError reports a violation of a validity constraint of the DTD.
+type ValidityError struct {
+	// name of the constraint in the XML specification, e.g. "Element Valid"
+	Constraint string
+	Err        error
+	Pos        Pos
+}
+
+func newValidityErr(constraint string, err error, pos Pos) *ValidityError {
+	return &ValidityError{
+		Constraint: constraint,
+		Err:        err,
+		Pos:        pos,
+	}
+}
+
+func (e *ValidityError) Error() string {
+	return fmt.Sprintf("validity constraint %s violated at line %d column %d: %s", e.Constraint, e.Pos.Line, e.Pos.Col, e.Err.Error())
+}
+
+func (e *ValidityError) Unwrap() error {
+	return e.Err
+}
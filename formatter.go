@@ -87,6 +87,10 @@ func (f *Formatter) format(a AST, depth int) {
 		f.formatXMLDecl(v, depth)
 	case *DOCType:
 		f.FormatDOCType(v, depth)
+	case *DTD:
+		f.FormatDTD(v, depth)
+	case *CondSect:
+		f.FormatCondSect(v, depth)
 	case *Element:
 		f.FormatElement(v, depth)
 	case Terminal:
@@ -106,6 +110,9 @@ func (f *Formatter) formatXML(x *XML, depth int) {
 	f.format(x.Element, depth)
 	f.ln()
 	for _, m := range x.Misc {
+		if _, ok := m.(*Space); ok {
+			continue
+		}
 		f.insertIndent(depth)
 		f.format(m, depth)
 	}
@@ -146,7 +153,7 @@ func (f *Formatter) FormatDOCType(d *DOCType, depth int) {
 		f.printf(" %s", d.ExtID.ToString())
 	}
 
-	hasMarkups := len(d.Markups) > 0 || d.PERef != nil
+	hasMarkups := len(d.Markups) > 0
 
 	if hasMarkups {
 		f.println(" [")
@@ -155,10 +162,6 @@ func (f *Formatter) FormatDOCType(d *DOCType, depth int) {
 		f.format(m, depth+1)
 		f.ln()
 	}
-	if d.PERef != nil {
-		f.format(d.PERef, depth+1)
-		f.ln()
-	}
 	if hasMarkups {
 		f.insertIndent(depth)
 		f.print("]")
@@ -166,6 +169,44 @@ func (f *Formatter) FormatDOCType(d *DOCType, depth int) {
 	f.print(">")
 }
 
+func (f *Formatter) FormatDTD(d *DTD, depth int) {
+	if d == nil {
+		return
+	}
+	if d.TextDecl != nil {
+		f.format(d.TextDecl, depth)
+		f.ln()
+	}
+	for _, m := range d.Markups {
+		f.format(m, depth)
+		f.ln()
+	}
+}
+
+func (f *Formatter) FormatCondSect(c *CondSect, depth int) {
+	if c == nil {
+		return
+	}
+	if c.Keyword != "INCLUDE" {
+		f.insertIndent(depth)
+		f.print(c.ToString())
+		return
+	}
+	f.insertIndent(depth)
+	if c.KeywordRef != nil {
+		f.printf("<![%s[", c.KeywordRef.ToString())
+	} else {
+		f.printf("<![%s[", c.Keyword)
+	}
+	f.ln()
+	for _, m := range c.Markups {
+		f.format(m, depth+1)
+		f.ln()
+	}
+	f.insertIndent(depth)
+	f.print("]]>")
+}
+
 func (f *Formatter) FormatElement(e *Element, depth int) {
 	if e == nil {
 		return
@@ -193,6 +234,8 @@ func (f *Formatter) FormatElement(e *Element, depth int) {
 				f.ln()
 				f.insertIndent(depth)
 			}
+		case *CharData:
+			f.print(textEscaper.Replace(v.Value))
 		case AST:
 			f.ln()
 			f.format(v, depth+1)
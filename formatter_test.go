@@ -140,9 +140,9 @@ func TestFormatter_FormatDOCType(t *testing.T) {
 								Pubid: "VRML 1.0",
 							},
 						},
-					},
-					PERef: &PERef{
-						Name: "a",
+						&PERef{
+							Name: "a",
+						},
 					},
 				},
 				depth: 0,
@@ -171,6 +171,52 @@ func TestFormatter_FormatDOCType(t *testing.T) {
 	}
 }
 
+func TestFormatter_FormatDTD(t *testing.T) {
+	d := &DTD{
+		TextDecl: &TextDecl{Encoding: "UTF-8"},
+		Markups: []Markup{
+			&ElementDecl{Name: "code", ContentSpec: &Mixed{}},
+			&PERef{Name: "a"},
+		},
+	}
+	want := `<?xml encoding="UTF-8"?>
+<!ELEMENT code (#PCDATA)>
+%a;
+`
+	var buf bytes.Buffer
+	f := &Formatter{
+		Writer: &buf,
+	}
+	f.FormatDTD(d, 0)
+	if buf.String() != want {
+		t.Errorf("want %q, but got %q", want, buf.String())
+	}
+}
+
+func TestFormatter_FormatCondSect(t *testing.T) {
+	c := &CondSect{
+		Keyword:    "INCLUDE",
+		KeywordRef: &PERef{Name: "draft"},
+		Markups: []Markup{
+			&ElementDecl{Name: "a", ContentSpec: &EMPTY{}},
+			&CondSect{Keyword: "IGNORE", Ignored: " x "},
+		},
+	}
+	want := `<![%draft;[
+	<!ELEMENT a EMPTY>
+	<![IGNORE[ x ]]>
+]]>`
+	var buf bytes.Buffer
+	f := &Formatter{
+		Indent: "\t",
+		Writer: &buf,
+	}
+	f.FormatCondSect(c, 0)
+	if buf.String() != want {
+		t.Errorf("want %q, but got %q", want, buf.String())
+	}
+}
+
 func TestFormatter_FormatElement(t *testing.T) {
 	type args struct {
 		e     *Element
@@ -229,7 +275,7 @@ func TestFormatter_FormatElement(t *testing.T) {
 						&PERef{
 							Name: "peref",
 						},
-						Comment("comment"),
+						&Comment{Value: "comment"},
 						&Element{
 							Name: "child2",
 							Contents: []interface{}{
@@ -263,3 +309,19 @@ func TestFormatter_FormatElement(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatter_escapesExpandedText(t *testing.T) {
+	x, err := Parse(`<a b="&lt;&quot;">x &lt; y &amp; z</a>`, ExpandEntities())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	NewFormatter(Writer(&buf)).FormatElement(x.Element, 0)
+	want := `<a b="&lt;&quot;">x &lt; y &amp; z</a>`
+	if buf.String() != want {
+		t.Errorf("want %q, but got %q", want, buf.String())
+	}
+	if _, err := Parse(buf.String()); err != nil {
+		t.Errorf("formatted output does not parse: %v", err)
+	}
+}
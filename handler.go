@@ -0,0 +1,72 @@
+package xml
+
+import (
+	"io"
+)
+
+// Handler receives the constructs of a document in order
+// while it is parsed by ParseHandler.
+// Returning an error from any method aborts parsing with that error.
+type Handler interface {
+	XMLDecl(x *XMLDecl) error
+	DOCType(d *DOCType) error
+	// StartElement is followed by EndElement even for an empty-element tag.
+	StartElement(e *StartElement) error
+	EndElement(e *EndElement) error
+	CharData(c *CharData) error
+	CDATA(c *CData) error
+	Comment(c *Comment) error
+	PI(pi *PI) error
+	EntityRef(ref *EntityRef) error
+	CharRef(ref *CharRef) error
+}
+
+// NopHandler implements Handler doing nothing.
+// Embed it to handle only some of the events.
+type NopHandler struct{}
+
+func (NopHandler) XMLDecl(*XMLDecl) error           { return nil }
+func (NopHandler) DOCType(*DOCType) error           { return nil }
+func (NopHandler) StartElement(*StartElement) error { return nil }
+func (NopHandler) EndElement(*EndElement) error     { return nil }
+func (NopHandler) CharData(*CharData) error         { return nil }
+func (NopHandler) CDATA(*CData) error               { return nil }
+func (NopHandler) Comment(*Comment) error           { return nil }
+func (NopHandler) PI(*PI) error                     { return nil }
+func (NopHandler) EntityRef(*EntityRef) error       { return nil }
+func (NopHandler) CharRef(*CharRef) error           { return nil }
+
+// ParseHandler parses a document read from r and reports it to h
+// without building the Element tree.
+func ParseHandler(r io.Reader, h Handler, opts ...ParseOption) error {
+	d := NewDecoder(r, opts...)
+	for d.Next() {
+		var err error
+		switch t := d.Token().(type) {
+		case *XMLDecl:
+			err = h.XMLDecl(t)
+		case *DOCType:
+			err = h.DOCType(t)
+		case *StartElement:
+			err = h.StartElement(t)
+		case *EndElement:
+			err = h.EndElement(t)
+		case *CharData:
+			err = h.CharData(t)
+		case *CData:
+			err = h.CDATA(t)
+		case *Comment:
+			err = h.Comment(t)
+		case *PI:
+			err = h.PI(t)
+		case *EntityRef:
+			err = h.EntityRef(t)
+		case *CharRef:
+			err = h.CharRef(t)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return d.Err()
+}
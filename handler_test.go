@@ -0,0 +1,172 @@
+package xml
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type recordHandler struct {
+	events []string
+	stopAt string
+}
+
+func (h *recordHandler) record(format string, a ...interface{}) error {
+	e := fmt.Sprintf(format, a...)
+	h.events = append(h.events, e)
+	if e == h.stopAt {
+		return errors.New("stop")
+	}
+	return nil
+}
+
+func (h *recordHandler) XMLDecl(x *XMLDecl) error { return h.record("xmldecl %s", x.Version) }
+func (h *recordHandler) DOCType(d *DOCType) error { return h.record("doctype %s", d.Name) }
+func (h *recordHandler) StartElement(e *StartElement) error {
+	return h.record("start %s %s", e.Name, e.Attrs.ToString())
+}
+func (h *recordHandler) EndElement(e *EndElement) error { return h.record("end %s", e.Name) }
+func (h *recordHandler) CharData(c *CharData) error     { return h.record("chardata %s", c.Value) }
+func (h *recordHandler) CDATA(c *CData) error           { return h.record("cdata %s", c.Value) }
+func (h *recordHandler) Comment(c *Comment) error       { return h.record("comment %s", c.Value) }
+func (h *recordHandler) PI(pi *PI) error                { return h.record("pi %s", pi.Target) }
+func (h *recordHandler) EntityRef(ref *EntityRef) error { return h.record("entityref %s", ref.Name) }
+func (h *recordHandler) CharRef(ref *CharRef) error     { return h.record("charref %s", ref.Value) }
+
+func TestParseHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		stopAt  string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "all",
+			source: `<?xml version="1.0"?><!--c1--><!DOCTYPE root><?pi1?>
+<root a="b">text<child/>&amp;&#65;<![CDATA[<cdata>]]><!--c2--><?pi2 x?>
+	<child>inner</child>
+</root><!--c3-->`,
+			want: []string{
+				"xmldecl 1.0",
+				"comment c1",
+				"doctype root",
+				"pi pi1",
+				`start root a="b"`,
+				"chardata text",
+				"start child ",
+				"end child",
+				"entityref amp",
+				"charref 65",
+				"cdata <cdata>",
+				"comment c2",
+				"pi pi2",
+				"start child ",
+				"chardata inner",
+				"end child",
+				"end root",
+				"comment c3",
+			},
+		},
+		{
+			name:   "stop by handler",
+			source: `<root><a/><b/></root>`,
+			stopAt: "end a",
+			want: []string{
+				"start root ",
+				"start a ",
+				"end a",
+			},
+			wantErr: true,
+		},
+		{
+			name:   "mismatched end tag",
+			source: `<root><a></b></root>`,
+			want: []string{
+				"start root ",
+				"start a ",
+			},
+			wantErr: true,
+		},
+		{
+			name:   "broken reference",
+			source: `<root>&a</root>`,
+			want: []string{
+				"start root ",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &recordHandler{stopAt: tt.stopAt}
+			err := ParseHandler(strings.NewReader(tt.source), h)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseHandler() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(h.events, tt.want) {
+				t.Errorf("ParseHandler() events = %q, want %q", h.events, tt.want)
+			}
+		})
+	}
+}
+
+type countHandler struct {
+	NopHandler
+	count int
+}
+
+func (h *countHandler) StartElement(*StartElement) error {
+	h.count++
+	return nil
+}
+
+func TestNopHandler(t *testing.T) {
+	h := &countHandler{}
+	if err := ParseHandler(strings.NewReader(`<a><b/><c><d/></c></a>`), h); err != nil {
+		t.Fatal(err)
+	}
+	if h.count != 4 {
+		t.Errorf("count = %d, want %d", h.count, 4)
+	}
+}
+
+type elementHandler struct {
+	NopHandler
+	starts []*StartElement
+	ends   []*EndElement
+}
+
+func (h *elementHandler) StartElement(e *StartElement) error {
+	h.starts = append(h.starts, e)
+	return nil
+}
+
+func (h *elementHandler) EndElement(e *EndElement) error {
+	h.ends = append(h.ends, e)
+	return nil
+}
+
+func TestParseHandler_elements(t *testing.T) {
+	h := &elementHandler{}
+	err := ParseHandler(strings.NewReader(`<a xmlns:p="urn:p">
+  <p:b/></a>`), h, Namespaces())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.starts) != 2 || len(h.ends) != 2 {
+		t.Fatalf("got %d starts and %d ends, want 2 each", len(h.starts), len(h.ends))
+	}
+	b := h.starts[1]
+	if b.NamespaceURI != "urn:p" || b.LocalName != "b" {
+		t.Errorf("StartElement namespace = %q %q, want %q %q", b.NamespaceURI, b.LocalName, "urn:p", "b")
+	}
+	if want := (Pos{Line: 2, Col: 3, Offset: 22}); b.Start != want {
+		t.Errorf("StartElement at %v, want %v", b.Start, want)
+	}
+	if want := (Pos{Line: 2, Col: 9, Offset: 28}); h.ends[1].Start != want {
+		t.Errorf("EndElement at %v, want %v", h.ends[1].Start, want)
+	}
+}
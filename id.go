@@ -0,0 +1,136 @@
+package xml
+
+import (
+	"strings"
+)
+
+// IDs returns the elements of x by the values of their attributes
+// declared as ID in its DTD. A value used more than once maps to the
+// first element that has it.
+func IDs(x *XML) map[string]*Element {
+	ids := map[string]*Element{}
+	if x.Prolog == nil || x.Prolog.DOCType == nil || x.Element == nil {
+		return ids
+	}
+	defs := newAttDefs()
+	declareAttDefs(defs, x.Prolog.DOCType.Markups)
+	declareAttDefs(defs, x.Prolog.DOCType.ExtSubset)
+	indexIDs(ids, defs, x.Element)
+	return ids
+}
+
+// declareAttDefs records the attribute definitions in markups and in their
+// INCLUDE sections.
+func declareAttDefs(defs attDefs, markups []Markup) {
+	for _, m := range markups {
+		switch m := m.(type) {
+		case *Attlist:
+			for _, def := range m.Defs {
+				defs.add(m.Name, def)
+			}
+		case *CondSect:
+			if m.Keyword == "INCLUDE" {
+				declareAttDefs(defs, m.Markups)
+			}
+		}
+	}
+}
+
+// indexIDs records e and its descendants in ids by the values of their ID
+// attributes.
+func indexIDs(ids map[string]*Element, defs attDefs, e *Element) {
+	for _, a := range e.Attrs {
+		if def := defs.get(e.Name, a.Name); def == nil || def.Type != AttTokenID {
+			continue
+		}
+		value, err := normalizeAttValue(a.AttValue, true).Text()
+		if err != nil || !isName(value) {
+			continue
+		}
+		if _, ok := ids[value]; !ok {
+			ids[value] = e
+		}
+	}
+	for _, c := range e.Contents {
+		if c, ok := c.(*Element); ok {
+			indexIDs(ids, defs, c)
+		}
+	}
+}
+
+// GetElementByID returns the element whose attribute declared as ID has
+// the value id, or nil if there is none. The first call indexes the IDs
+// of x, which later changes to x do not update. It is safe to call
+// concurrently.
+func (x *XML) GetElementByID(id string) *Element {
+	ids, ok := x.ids.Load().(map[string]*Element)
+	if !ok {
+		// of concurrent first calls, the index of the first to finish is kept
+		x.ids.CompareAndSwap(nil, IDs(x))
+		ids = x.ids.Load().(map[string]*Element)
+	}
+	return ids[id]
+}
+
+// idRef is a value of an attribute of type IDREF or IDREFS.
+type idRef struct {
+	name string
+	attr *Attribute
+	elem *Element
+}
+
+// id records value of the ID attribute a of e.
+func (v *validator) id(e *Element, a *Attribute, value string) {
+	// VC: ID
+	if !isName(value) {
+		v.report("ID", a.Start, "value %q of ID attribute %q is not a name", value, a.Name)
+		return
+	}
+	if prev, ok := v.ids[value]; ok {
+		v.report("ID", a.Start, "ID %q of element %q is already used by element %q at line %d column %d", value, e.Name, prev.Name, prev.STag.Start.Line, prev.STag.Start.Col)
+		return
+	}
+	v.ids[value] = e
+}
+
+// idRefs records the names in value of the IDREF or IDREFS attribute a of e.
+func (v *validator) idRefs(e *Element, a *Attribute, def *AttDef, value string) {
+	names := []string{value}
+	if def.Type == AttTokenIDREFS {
+		names = strings.Split(value, " ")
+	}
+	for _, name := range names {
+		if !isName(name) {
+			v.report("IDREF", a.Start, "value %q of %s attribute %q is not a name", name, def.Type.ToString(), a.Name)
+			return
+		}
+	}
+	for _, name := range names {
+		v.refs = append(v.refs, idRef{name: name, attr: a, elem: e})
+	}
+}
+
+// checkIDRefs reports the recorded IDREF values that match no ID.
+func (v *validator) checkIDRefs() {
+	// VC: IDREF
+	for _, ref := range v.refs {
+		if _, ok := v.ids[ref.name]; !ok {
+			v.report("IDREF", ref.attr.Start, "attribute %q of element %q refers to undefined ID %q", ref.attr.Name, ref.elem.Name, ref.name)
+		}
+	}
+}
+
+// declareID checks the definition def of an ID attribute of element name.
+func (v *validator) declareID(name string, def *AttDef) {
+	// VC: One ID per Element Type
+	for _, d := range v.attDefs.of(name) {
+		if d.Type == AttTokenID {
+			v.report("One ID per Element Type", def.Start, "element type %q already has the ID attribute %q", name, d.Name)
+			break
+		}
+	}
+	// VC: ID Attribute Default
+	if def.Decl != nil && def.Decl.Type != DefaultDeclTypeImplied && def.Decl.Type != DefaultDeclTypeRequired {
+		v.report("ID Attribute Default", def.Start, "ID attribute %q must be declared #IMPLIED or #REQUIRED", def.Name)
+	}
+}
@@ -0,0 +1,70 @@
+package xml
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestXML_GetElementByID(t *testing.T) {
+	const source = `<!DOCTYPE manual [
+<!ATTLIST section id ID #IMPLIED see IDREFS #IMPLIED>
+<!ATTLIST link to IDREF #REQUIRED id CDATA #IMPLIED><!ATTLIST link id ID #IMPLIED>
+]>
+<manual>
+	<section id="intro"><link to="usage"/></section>
+	<section id=" usage " see="intro"/>
+	<section id="intro"/>
+	<link id="notID" to="intro"/>
+</manual>`
+	x, err := Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{id: "intro", want: "6:2"},
+		{id: "usage", want: "7:2"},
+		{id: "notID"},
+		{id: "missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			var got string
+			if e := x.GetElementByID(tt.id); e != nil {
+				got = fmt.Sprintf("%d:%d", e.STag.Start.Line, e.STag.Start.Col)
+			}
+			if got != tt.want {
+				t.Errorf("GetElementByID(%q) at %q, want %q", tt.id, got, tt.want)
+			}
+		})
+	}
+	// later calls look up the index built by the first
+	x.Element.Contents = nil
+	if x.GetElementByID("usage") == nil {
+		t.Error("GetElementByID() walked the changed document again")
+	}
+	if got := IDs(&XML{}); len(got) != 0 {
+		t.Errorf("IDs() of empty document = %v", got)
+	}
+}
+
+func TestXML_GetElementByID_concurrent(t *testing.T) {
+	x, err := Parse(`<!DOCTYPE a [<!ATTLIST b id ID #IMPLIED>]><a><b id="x"/><b id="y"/></a>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if x.GetElementByID("y") == nil {
+				t.Error("GetElementByID(\"y\") = nil")
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,238 @@
+package xml
+
+import (
+	"fmt"
+	"sort"
+)
+
+// LintKind is the kind of a problem reported by Lint.
+type LintKind int
+
+const (
+	// a parameter entity that is not referenced in the DTD
+	LintUnusedEntity LintKind = iota
+	// an ATTLIST for an element type that has no ELEMENT declaration
+	LintUndeclaredAttlistElement
+	// an element type in a content model that has no ELEMENT declaration
+	LintUndeclaredContentElement
+	// an attribute defined more than once for an element type
+	LintDuplicateAttDef
+)
+
+// LintIssue is a problem found in a DTD by Lint.
+type LintIssue struct {
+	Kind LintKind
+	// name of the parameter entity, element type or attribute
+	Name string
+	// declaration the problem is found in
+	Decl Markup
+	Pos  Pos
+}
+
+func (i *LintIssue) String() string {
+	var msg string
+	switch i.Kind {
+	case LintUnusedEntity:
+		msg = fmt.Sprintf("parameter entity %q is never referenced", i.Name)
+	case LintUndeclaredAttlistElement:
+		msg = fmt.Sprintf("attribute list of undeclared element type %q", i.Name)
+	case LintUndeclaredContentElement:
+		msg = fmt.Sprintf("element type %q in content model is not declared", i.Name)
+	case LintDuplicateAttDef:
+		msg = fmt.Sprintf("attribute %q is already defined", i.Name)
+	}
+	return fmt.Sprintf("line %d column %d: %s", i.Pos.Line, i.Pos.Col, msg)
+}
+
+// Lint looks for unused and undeclared definitions in markups, such as
+// DOCType.Markups or DTD.Markups, including their conditional sections,
+// and returns them in source order. The declarations in internal
+// parameter entities that markups refer to are read as well, and problems
+// in them are reported at the reference. When other declarations cannot
+// be read, as those of external parameter entities, element types are not
+// reported as undeclared. A DTD that refers to parameter entities within
+// declarations is read by ParseDTD with ExpandParameterEntities; the
+// references replaced are then seen in the PERefs of the declarations, so
+// a parameter entity expanded to no declarations is reported as unused.
+//
+// General entities are referred to by documents rather than the DTD, so
+// they are never reported as unused.
+func Lint(markups []Markup) []*LintIssue {
+	l := &linter{
+		entities:  map[string]*Entity{},
+		used:      map[string]bool{},
+		elements:  map[string]bool{},
+		expanding: map[string]bool{},
+		expanded:  map[*PERef][]Markup{},
+		attDefs:   newAttDefs(),
+	}
+	l.declare(markups)
+	l.check(markups)
+
+	for name, e := range l.entities {
+		if !l.used[name] {
+			l.report(LintUnusedEntity, e.Name, e, e.Start)
+		}
+	}
+	sort.SliceStable(l.issues, func(i, j int) bool {
+		return l.issues[i].Pos.Offset < l.issues[j].Pos.Offset
+	})
+	return l.issues
+}
+
+type linter struct {
+	// parameter entities by name, and whether they are referenced
+	entities map[string]*Entity
+	used     map[string]bool
+	elements map[string]bool
+	// parameter entities being read
+	expanding map[string]bool
+	// declarations read from the references to parameter entities
+	expanded map[*PERef][]Markup
+	// whether some declarations could not be read
+	incomplete bool
+	attDefs    attDefs
+	issues     []*LintIssue
+}
+
+func (l *linter) report(kind LintKind, name string, decl Markup, pos Pos) {
+	l.issues = append(l.issues, &LintIssue{
+		Kind: kind,
+		Name: name,
+		Decl: decl,
+		Pos:  pos,
+	})
+}
+
+// declare records the parameter entities and element types declared in
+// markups and the references to parameter entities made in them.
+func (l *linter) declare(markups []Markup) {
+	for _, m := range markups {
+		switch m := m.(type) {
+		case *ElementDecl:
+			l.elements[m.Name] = true
+			l.usePERefs(m.PERefs)
+		case *Entity:
+			l.usePERefs(m.PERefs)
+			if _, ok := l.entities[m.Name]; !ok && m.Type == EntityTypePE {
+				l.entities[m.Name] = m
+			}
+			for _, v := range m.Value {
+				if ref, ok := v.(*PERef); ok {
+					l.used[ref.Name] = true
+				}
+			}
+		case *Attlist:
+			l.usePERefs(m.PERefs)
+		case *Notation:
+			l.usePERefs(m.PERefs)
+		case *PERef:
+			l.used[m.Name] = true
+			l.expand(m)
+		case *CondSect:
+			if m.KeywordRef != nil {
+				l.used[m.KeywordRef.Name] = true
+			}
+			if len(m.Keyword) == 0 {
+				l.incomplete = true
+			}
+			l.declare(m.Markups)
+		}
+	}
+}
+
+// usePERefs records the parameter entities refs refer to.
+func (l *linter) usePERefs(refs []*PERef) {
+	for _, ref := range refs {
+		l.used[ref.Name] = true
+	}
+}
+
+// expand declares the markup in the internal parameter entity ref refers to,
+// which check then reads at ref.
+func (l *linter) expand(ref *PERef) {
+	e, ok := l.entities[ref.Name]
+	if !ok || e.ExtID != nil || l.expanding[ref.Name] {
+		l.incomplete = true
+		return
+	}
+	text, err := replacementText(e.Value)
+	if err != nil {
+		l.incomplete = true
+		return
+	}
+	p := newParser(text)
+	p.startDTD()
+	p.external = true
+	markups, err := p.parseDecls(nil)
+	if err != nil {
+		l.incomplete = true
+		return
+	}
+	// problems in the replacement text are reported at the reference
+	moveDeclSpans(markups, ref.Span)
+	l.expanded[ref] = markups
+	l.expanding[ref.Name] = true
+	l.declare(markups)
+	delete(l.expanding, ref.Name)
+}
+
+// check reports the problems of the declarations in markups.
+func (l *linter) check(markups []Markup) {
+	for _, m := range markups {
+		switch m := m.(type) {
+		case *ElementDecl:
+			l.contentSpec(m)
+		case *Attlist:
+			l.attlist(m)
+		case *CondSect:
+			l.check(m.Markups)
+		case *PERef:
+			l.check(l.expanded[m])
+		}
+	}
+}
+
+func (l *linter) contentSpec(decl *ElementDecl) {
+	if l.incomplete {
+		return
+	}
+	switch spec := decl.ContentSpec.(type) {
+	case *Mixed:
+		for _, name := range spec.Names {
+			if !l.elements[name] {
+				l.report(LintUndeclaredContentElement, name, decl, spec.Start)
+			}
+		}
+	case *Children:
+		l.particle(decl, CP{ChoiceSeq: spec.ChoiceSeq})
+	}
+}
+
+func (l *linter) particle(decl *ElementDecl, cp CP) {
+	switch v := cp.ChoiceSeq.(type) {
+	case *Choice:
+		for _, cp := range v.CPs {
+			l.particle(decl, cp)
+		}
+	case *Seq:
+		for _, cp := range v.CPs {
+			l.particle(decl, cp)
+		}
+	default:
+		if !l.elements[cp.Name] {
+			l.report(LintUndeclaredContentElement, cp.Name, decl, cp.Start)
+		}
+	}
+}
+
+func (l *linter) attlist(a *Attlist) {
+	if !l.elements[a.Name] && !l.incomplete {
+		l.report(LintUndeclaredAttlistElement, a.Name, a, a.Start)
+	}
+	for _, def := range a.Defs {
+		if !l.attDefs.add(a.Name, def) {
+			l.report(LintDuplicateAttDef, def.Name, a, def.Start)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package xml
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		opts   []ParseOption
+		want   []string
+	}{
+		{
+			name: "clean",
+			source: `<!ENTITY % common "<!ELEMENT b EMPTY>">
+%common;
+<!ENTITY lt "&#38;#60;">
+<!ENTITY e "&f;">
+<!ENTITY f "f">
+<!ENTITY pic SYSTEM "pic.gif" NDATA gif>
+<!ENTITY % inc "INCLUDE">
+<![%inc;[<!ELEMENT a (b | c)*>]]>
+<!ELEMENT c (#PCDATA | b)*>
+<!ATTLIST a x CDATA "&e;" p ENTITY "pic">`,
+		},
+		{
+			name: "problems",
+			source: `<!ENTITY document "x">
+<!ENTITY % unusedPE "y">
+<!ELEMENT a (b, (c | d)?)>
+<!ELEMENT b (#PCDATA | i)*>
+<!ELEMENT c EMPTY>
+<!ATTLIST a x CDATA #IMPLIED>
+<!ATTLIST a x CDATA #IMPLIED y CDATA #IMPLIED y NMTOKEN #IMPLIED>
+<![IGNORE[<!ELEMENT d EMPTY>]]>
+<![INCLUDE[<!ATTLIST x x CDATA #IMPLIED>]]>`,
+			want: []string{
+				"2:1 0 unusedPE",
+				"3:22 2 d",
+				"4:13 2 i",
+				"7:13 3 x",
+				"7:47 3 y",
+				"9:12 1 x",
+			},
+		},
+		{
+			name: "unread declarations",
+			source: `<!ENTITY % ext SYSTEM "ext.dtd">
+%ext;
+<!ELEMENT a (b)>
+<!ATTLIST c x CDATA #IMPLIED x CDATA #IMPLIED>`,
+			want: []string{"4:30 3 x"},
+		},
+		{
+			name: "parameter entities within declarations",
+			source: `<!ENTITY % local.inline "">
+<!ENTITY % inline "emphasis | link %local.inline;">
+<!ENTITY % common.attrs "id ID #IMPLIED">
+<!ELEMENT para (#PCDATA | %inline;)*>
+<!ATTLIST para %common.attrs;>
+<!ELEMENT emphasis (#PCDATA | %inline;)*>
+<!ELEMENT link (#PCDATA)>`,
+			opts: []ParseOption{ExpandParameterEntities()},
+		},
+		{
+			name: "problems at references",
+			source: `<!ENTITY % decls "<!ENTITY &#37; unused 'x'><!ATTLIST z a CDATA #IMPLIED>">
+%decls;
+<!ENTITY % inline "b | missing">
+<!ELEMENT p (#PCDATA | %inline;)*>
+<!ELEMENT b EMPTY>`,
+			opts: []ParseOption{ExpandParameterEntities()},
+			want: []string{
+				"2:1 1 z",
+				"2:1 0 unused",
+				"4:1 2 missing",
+			},
+		},
+		{
+			name: "problems at references not expanded",
+			source: `<!ENTITY % decls "<!ENTITY &#37; unused 'x'>">
+%decls;`,
+			want: []string{"2:1 0 unused"},
+		},
+		{
+			name: "declarations at references not expanded",
+			source: `<!ENTITY % decls "<!ELEMENT a (b)><!ATTLIST a x CDATA #IMPLIED x CDATA #IMPLIED><!ATTLIST zz y CDATA #IMPLIED>">
+%decls;`,
+			want: []string{
+				"2:1 2 b",
+				"2:1 3 x",
+				"2:1 1 zz",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := ParseDTD(strings.NewReader(tt.source), tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, issue := range Lint(d.Markups) {
+				got = append(got, fmt.Sprintf("%d:%d %d %s", issue.Pos.Line, issue.Pos.Col, issue.Kind, issue.Name))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLint_DOCType(t *testing.T) {
+	x, err := Parse(`<!DOCTYPE a [<!ATTLIST a x CDATA #IMPLIED>]><a/>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues := Lint(x.Prolog.DOCType.Markups)
+	want := `line 1 column 14: attribute list of undeclared element type "a"`
+	if len(issues) != 1 || issues[0].String() != want {
+		t.Errorf("Lint() = %v, want [%s]", issues, want)
+	}
+}
@@ -0,0 +1,104 @@
+package xml
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	xmlNamespace   = "http://www.w3.org/XML/1998/namespace"
+	xmlnsNamespace = "http://www.w3.org/2000/xmlns/"
+)
+
+// setNamespaces adds the namespaces declared by the attributes of e to those
+// in scope, resolves the names of e and its attributes, and returns a function
+// restoring the enclosing declarations.
+// It does nothing without the Namespaces option.
+func (p *parser) setNamespaces(e *Element) (func(), error) {
+	old := p.namespaces
+	restore := func() {
+		p.namespaces = old
+	}
+	if old == nil {
+		return restore, nil
+	}
+
+	copied := false
+	for _, a := range e.Attrs {
+		var prefix string
+		if a.Name == "xmlns" {
+			prefix = ""
+		} else if strings.HasPrefix(a.Name, "xmlns:") {
+			prefix = a.Name[len("xmlns:"):]
+		} else {
+			continue
+		}
+		uri, err := normalizeAttValue(a.AttValue, false).Text()
+		if err != nil {
+			return restore, newErr(p.parsing, fmt.Errorf("namespace name of %s: %w", a.Name, err), a.Span.Start)
+		}
+		if err := checkDecl(prefix, uri); err != nil {
+			return restore, newErr(p.parsing, err, a.Span.Start)
+		}
+		if !copied {
+			p.namespaces = make(map[string]string, len(old)+1)
+			for k, v := range old {
+				p.namespaces[k] = v
+			}
+			copied = true
+		}
+		p.namespaces[prefix] = uri
+	}
+
+	var err error
+	if e.NamespaceURI, e.LocalName, err = p.resolve(e.Name, true); err != nil {
+		return restore, newErr(p.parsing, err, e.STag.Start)
+	}
+	for _, a := range e.Attrs {
+		if a.NamespaceURI, a.LocalName, err = p.resolve(a.Name, false); err != nil {
+			return restore, newErr(p.parsing, err, a.Span.Start)
+		}
+	}
+	return restore, nil
+}
+
+// resolve splits a QName into the namespace name bound to its prefix and its
+// local part. The default namespace applies to element names only.
+func (p *parser) resolve(name string, isElement bool) (string, string, error) {
+	if name == "xmlns" {
+		return xmlnsNamespace, name, nil
+	}
+	i := strings.IndexByte(name, ':')
+	if i < 0 {
+		if isElement {
+			return p.namespaces[""], name, nil
+		}
+		return "", name, nil
+	}
+	prefix, local := name[:i], name[i+1:]
+	if len(prefix) == 0 || len(local) == 0 || strings.IndexByte(local, ':') >= 0 {
+		return "", "", fmt.Errorf("invalid qualified name %q", name)
+	}
+	uri, ok := p.namespaces[prefix]
+	if !ok {
+		return "", "", fmt.Errorf("undeclared namespace prefix %q", prefix)
+	}
+	return uri, local, nil
+}
+
+// checkDecl reports a namespace declaration that Namespaces in XML forbids.
+func checkDecl(prefix, uri string) error {
+	switch {
+	case prefix == "xmlns":
+		return errors.New("prefix xmlns must not be declared")
+	case prefix == "xml" && uri != xmlNamespace, prefix != "xml" && uri == xmlNamespace:
+		return fmt.Errorf("prefix xml must be bound to %s only", xmlNamespace)
+	case uri == xmlnsNamespace:
+		return fmt.Errorf("%s must not be declared", xmlnsNamespace)
+	case len(prefix) > 0 && len(uri) == 0:
+		return fmt.Errorf("prefix %q must not be undeclared", prefix)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,224 @@
+package xml
+
+import (
+	"errors"
+	"io"
+)
+
+// ParseOption configures Parse, ParseBytes, ParseReader, NewDecoder and ParseHandler.
+type ParseOption func(*parser) error
+
+// CharsetReader sets a function that converts a document declaring
+// a charset other than UTF-8 into UTF-8. It replaces the built-in charsets.
+func CharsetReader(fn func(charset string, input io.Reader) (io.Reader, error)) ParseOption {
+	return func(p *parser) error {
+		p.charsetReader = fn
+		return nil
+	}
+}
+
+// PreserveWhitespace keeps character data consisting only of white space,
+// which is otherwise dropped unless an element declares xml:space="preserve".
+func PreserveWhitespace() ParseOption {
+	return func(p *parser) error {
+		p.keepWhitespace = true
+		p.preserveSpace = true
+		return nil
+	}
+}
+
+// Lossless records the white space, quotes, UTF-8 byte order mark and other
+// source text that Serialize needs to write an unmodified tree back byte
+// for byte.
+// It implies PreserveWhitespace.
+func Lossless() ParseOption {
+	return func(p *parser) error {
+		p.lossless = true
+		return PreserveWhitespace()(p)
+	}
+}
+
+// ExpandEntities replaces references to general entities in content and
+// attribute values by their replacement text, and rejects references to
+// entities that are not declared. Nodes read from a replacement text have
+// the position of the reference; references to external entities are kept.
+func ExpandEntities() ParseOption {
+	return func(p *parser) error {
+		p.expandEntities = true
+		return nil
+	}
+}
+
+// ExpandParameterEntities replaces references to parameter entities in the
+// internal DTD subset by the declarations in their replacement text.
+// A reference is kept in DOCType.Markups when its entity is external or not
+// declared before it. Declarations read from a replacement text have the
+// position of the reference and list it in their PERefs.
+func ExpandParameterEntities() ParseOption {
+	return func(p *parser) error {
+		p.expandPEs = true
+		return nil
+	}
+}
+
+// ApplyDefaults inserts the attributes an element omits that have a default
+// value in the DTD, marked Defaulted, and normalises attribute values as
+// declared: white space characters become spaces, character references and
+// predefined entities are replaced, and values of types other than CDATA
+// have leading and trailing spaces removed and runs of spaces collapsed.
+// Attributes that are not declared are normalised as CDATA.
+func ApplyDefaults() ParseOption {
+	return func(p *parser) error {
+		p.applyDefaults = true
+		return nil
+	}
+}
+
+// LoadExternal reads the external DTD subset and, with ExpandEntities and
+// ExpandParameterEntities, the external parsed entities that are referred
+// to. They are opened by FileResolver unless Resolver sets another, and
+// only if ExternalPolicy allows them: by default the parse fails with an
+// ExternalEntityError instead. References to parameter entities in the
+// external subset, including those in entity values, are always expanded.
+func LoadExternal() ParseOption {
+	return func(p *parser) error {
+		if p.resolver == nil {
+			p.resolver = FileResolver{}
+		}
+		return nil
+	}
+}
+
+// Resolver sets the EntityResolver opening external entities.
+// It implies LoadExternal.
+func Resolver(r EntityResolver) ParseOption {
+	return func(p *parser) error {
+		if r == nil {
+			return errors.New("Resolver must not be nil")
+		}
+		p.resolver = r
+		return nil
+	}
+}
+
+// ExternalPolicy sets the EntityPolicy deciding which external entities
+// LoadExternal may open, e.g. AllowDirs{"schemas"}.
+func ExternalPolicy(pol EntityPolicy) ParseOption {
+	return func(p *parser) error {
+		if pol == nil {
+			return errors.New("ExternalPolicy must not be nil")
+		}
+		p.policy = pol
+		return nil
+	}
+}
+
+// BaseURI sets the URI of the document, against which relative system
+// identifiers are resolved.
+func BaseURI(uri string) ParseOption {
+	return func(p *parser) error {
+		p.baseURI = uri
+		return nil
+	}
+}
+
+// Namespaces resolves the names of elements and attributes against
+// the xmlns declarations in scope, and rejects undeclared prefixes.
+func Namespaces() ParseOption {
+	return func(p *parser) error {
+		p.namespaces = map[string]string{
+			"xml":   xmlNamespace,
+			"xmlns": xmlnsNamespace,
+		}
+		return nil
+	}
+}
+
+// MaxSize fails the parse with ErrSizeLimit when the input is longer than n bytes.
+func MaxSize(n int64) ParseOption {
+	return func(p *parser) error {
+		if n <= 0 {
+			return errors.New("MaxSize must be positive")
+		}
+		p.maxSize = n
+		return nil
+	}
+}
+
+// MaxDepth fails the parse with ErrDepthLimit when elements nest deeper than n.
+func MaxDepth(n int) ParseOption {
+	return func(p *parser) error {
+		if n <= 0 {
+			return errors.New("MaxDepth must be positive")
+		}
+		p.maxDepth = n
+		return nil
+	}
+}
+
+// ExpansionLimits bounds the expansion of entities, protecting against
+// documents such as the "billion laughs" whose entities expand to far more
+// text than they are made of. A zero field sets no limit.
+type ExpansionLimits struct {
+	// maximum number of entities expanded within each other
+	MaxDepth int
+	// maximum total length in bytes of the replacement texts read; an
+	// external entity or DTD subset is not read past what remains of it
+	MaxSize int64
+	// maximum ratio of the total length of the replacement texts to the
+	// length of the input, checked once they exceed 1 MiB
+	MaxRatio float64
+}
+
+// DefaultExpansionLimits are the ExpansionLimits of a parse that does not
+// set others with LimitExpansion.
+var DefaultExpansionLimits = ExpansionLimits{
+	MaxDepth: 40,
+	MaxSize:  64 << 20,
+	MaxRatio: 100,
+}
+
+// LimitExpansion fails the parse with ErrExpansionLimit when expanding
+// entities exceeds l. LimitExpansion(ExpansionLimits{}) removes the limits.
+func LimitExpansion(l ExpansionLimits) ParseOption {
+	return func(p *parser) error {
+		if l.MaxDepth < 0 || l.MaxSize < 0 || l.MaxRatio < 0 {
+			return errors.New("ExpansionLimits must not be negative")
+		}
+		p.expansionLimits = l
+		return nil
+	}
+}
+
+// Strict rejects documents that are not well-formed in ways the parser
+// otherwise tolerates: white space before the XML declaration, content
+// after the document element and attributes specified twice in a tag.
+func Strict() ParseOption {
+	return func(p *parser) error {
+		p.strict = true
+		return nil
+	}
+}
+
+// limitReader reads at most n bytes from r and fails with ErrSizeLimit
+// if r has more.
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitReader) Read(b []byte) (int, error) {
+	if l.n <= 0 {
+		var one [1]byte
+		if m, err := l.r.Read(one[:]); m == 0 {
+			return 0, err
+		}
+		return 0, ErrSizeLimit
+	}
+	if int64(len(b)) > l.n {
+		b = b[:l.n]
+	}
+	m, err := l.r.Read(b)
+	l.n -= int64(m)
+	return m, err
+}
@@ -0,0 +1,254 @@
+package xml
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse_options(t *testing.T) {
+	// lol9 expands to 10^9 "lol"s
+	laughs := `<!DOCTYPE a [<!ENTITY lol0 "lol">`
+	for i := 1; i < 10; i++ {
+		laughs += fmt.Sprintf(`<!ENTITY lol%d "%s">`, i, strings.Repeat(fmt.Sprintf("&lol%d;", i-1), 10))
+	}
+	// a 10 KiB entity referred to 10000 times
+	quadratic := `<!DOCTYPE a [<!ENTITY big "` + strings.Repeat("x", 10<<10) + `">]><a>` + strings.Repeat("&big;", 10000) + `</a>`
+	// 2 MiB of replacement text from 10 KiB of input
+	ratio := `<!DOCTYPE a [<!ENTITY big "` + strings.Repeat("x", 10<<10) + `">]><a>` + strings.Repeat("&big;", 200) + `</a>`
+	nested := `<!DOCTYPE a [<!ENTITY e0 "x"><!ENTITY e1 "&e0;"><!ENTITY e2 "&e1;"><!ENTITY e3 "&e2;">]><a>&e3;</a>`
+
+	tests := []struct {
+		name    string
+		source  string
+		opts    []ParseOption
+		wantErr error
+	}{
+		{
+			name:   "leading space",
+			source: ` <?xml version="1.0"?><a/>`,
+		},
+		{
+			name:    "leading space with Strict",
+			source:  ` <?xml version="1.0"?><a/>`,
+			opts:    []ParseOption{Strict()},
+			wantErr: errAny,
+		},
+		{
+			name:   "content after document element",
+			source: `<a/><b/>`,
+		},
+		{
+			name:    "content after document element with Strict",
+			source:  `<a/><b/>`,
+			opts:    []ParseOption{Strict()},
+			wantErr: errAny,
+		},
+		{
+			name:   "duplicate attribute",
+			source: `<a><b c="1" c="2"/></a>`,
+		},
+		{
+			name:    "duplicate attribute with Strict",
+			source:  `<a><b c="1" c="2"/></a>`,
+			opts:    []ParseOption{Strict()},
+			wantErr: errAny,
+		},
+		{
+			name:   "MaxSize",
+			source: `<a>text</a>`,
+			opts:   []ParseOption{MaxSize(11)},
+		},
+		{
+			name:    "MaxSize exceeded",
+			source:  `<a>text</a>`,
+			opts:    []ParseOption{MaxSize(10)},
+			wantErr: ErrSizeLimit,
+		},
+		{
+			name:    "invalid MaxSize",
+			source:  `<a/>`,
+			opts:    []ParseOption{MaxSize(0)},
+			wantErr: errAny,
+		},
+		{
+			name:   "MaxDepth",
+			source: `<a><b><c/></b></a>`,
+			opts:   []ParseOption{MaxDepth(3)},
+		},
+		{
+			name:    "MaxDepth exceeded",
+			source:  `<a><b><c><d/></c></b></a>`,
+			opts:    []ParseOption{MaxDepth(3)},
+			wantErr: ErrDepthLimit,
+		},
+		{
+			name:    "billion laughs",
+			source:  laughs + `]><a>&lol9;</a>`,
+			opts:    []ParseOption{ExpandEntities()},
+			wantErr: ErrExpansionLimit,
+		},
+		{
+			name:    "billion laughs in attribute value",
+			source:  laughs + `]><a b="&lol9;"/>`,
+			opts:    []ParseOption{ExpandEntities()},
+			wantErr: ErrExpansionLimit,
+		},
+		{
+			name:    "quadratic blowup",
+			source:  quadratic,
+			opts:    []ParseOption{ExpandEntities()},
+			wantErr: ErrExpansionLimit,
+		},
+		{
+			name:    "expansion ratio exceeded",
+			source:  ratio,
+			opts:    []ParseOption{ExpandEntities()},
+			wantErr: ErrExpansionLimit,
+		},
+		{
+			name:   "expansion ratio without limits",
+			source: ratio,
+			opts:   []ParseOption{ExpandEntities(), LimitExpansion(ExpansionLimits{})},
+		},
+		{
+			name:   "expansion depth",
+			source: nested,
+			opts:   []ParseOption{ExpandEntities(), LimitExpansion(ExpansionLimits{MaxDepth: 4})},
+		},
+		{
+			name:    "expansion depth exceeded",
+			source:  nested,
+			opts:    []ParseOption{ExpandEntities(), LimitExpansion(ExpansionLimits{MaxDepth: 3})},
+			wantErr: ErrExpansionLimit,
+		},
+		{
+			name:    "expansion size exceeded",
+			source:  nested,
+			opts:    []ParseOption{ExpandEntities(), LimitExpansion(ExpansionLimits{MaxSize: 12})},
+			wantErr: ErrExpansionLimit,
+		},
+		{
+			name:    "invalid ExpansionLimits",
+			source:  `<a/>`,
+			opts:    []ParseOption{LimitExpansion(ExpansionLimits{MaxRatio: -1})},
+			wantErr: errAny,
+		},
+		{
+			name:    "undeclared prefix",
+			source:  `<a><p:b/></a>`,
+			opts:    []ParseOption{Namespaces()},
+			wantErr: errAny,
+		},
+		{
+			name:    "entity in namespace name",
+			source:  `<!DOCTYPE a [<!ENTITY e "urn:e">]><a xmlns="&e;"/>`,
+			opts:    []ParseOption{Namespaces()},
+			wantErr: errAny,
+		},
+		{
+			name:    "prefix out of scope",
+			source:  `<a><b xmlns:p="urn:p"/><p:c/></a>`,
+			opts:    []ParseOption{Namespaces()},
+			wantErr: errAny,
+		},
+		{
+			name:    "undeclaring a prefix",
+			source:  `<a xmlns:p=""/>`,
+			opts:    []ParseOption{Namespaces()},
+			wantErr: errAny,
+		},
+		{
+			name:   "prefix without Namespaces",
+			source: `<a><p:b/></a>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.source, tt.opts...)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Errorf("Parse() error = %v", err)
+			case tt.wantErr == errAny && err == nil:
+				t.Error("Parse() should fail")
+			case tt.wantErr != nil && tt.wantErr != errAny && !errors.Is(err, tt.wantErr):
+				t.Errorf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// errAny stands for any error in wantErr.
+var errAny = errors.New("any error")
+
+type name struct {
+	uri   string
+	local string
+}
+
+func TestParse_Namespaces(t *testing.T) {
+	x, err := Parse(`<a xmlns="urn:a" xmlns:p="urn:p" p:x="1" y="2"><p:b xmlns="urn:b"><c xml:lang="en"/></p:b></a>`, Namespaces())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := x.Element
+	b := a.Contents[0].(*Element)
+	c := b.Contents[0].(*Element)
+	got := []name{
+		{a.NamespaceURI, a.LocalName},
+		{a.Attrs[0].NamespaceURI, a.Attrs[0].LocalName},
+		{a.Attrs[2].NamespaceURI, a.Attrs[2].LocalName},
+		{a.Attrs[3].NamespaceURI, a.Attrs[3].LocalName},
+		{b.NamespaceURI, b.LocalName},
+		{c.NamespaceURI, c.LocalName},
+		{c.Attrs[0].NamespaceURI, c.Attrs[0].LocalName},
+	}
+	want := []name{
+		{"urn:a", "a"},
+		{xmlnsNamespace, "xmlns"},
+		{"urn:p", "x"},
+		{"", "y"},
+		{"urn:p", "b"},
+		{"urn:b", "c"},
+		{xmlNamespace, "lang"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("names = %v, want %v", got, want)
+	}
+}
+
+func TestParse_Namespaces_references(t *testing.T) {
+	x, err := Parse(`<a xmlns="http://e/?a=1&amp;b=2&#38;c=3"/>`, Namespaces())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := x.Element.NamespaceURI, "http://e/?a=1&b=2&c=3"; got != want {
+		t.Errorf("NamespaceURI = %q, want %q", got, want)
+	}
+}
+
+func TestDecoder_options(t *testing.T) {
+	d := NewDecoder(strings.NewReader(`<p:a xmlns:p="urn:p"><b/></p:a>`), Namespaces(), MaxDepth(1))
+	if !d.Next() {
+		t.Fatal(d.Err())
+	}
+	if s := d.Token().(*StartElement); s.NamespaceURI != "urn:p" || s.LocalName != "a" {
+		t.Errorf("StartElement = %q %q", s.NamespaceURI, s.LocalName)
+	}
+	if d.Next() {
+		t.Fatalf("Next() = %v, want ErrDepthLimit", d.Token())
+	}
+	if !errors.Is(d.Err(), ErrDepthLimit) {
+		t.Errorf("Err() = %v, want ErrDepthLimit", d.Err())
+	}
+
+	d = NewDecoder(strings.NewReader(`<a/>text`), Strict())
+	for d.Next() {
+	}
+	var xerr *XMLError
+	if !errors.As(d.Err(), &xerr) || xerr.Parsing != "Misc" {
+		t.Errorf("Err() = %v, want content after the document element", d.Err())
+	}
+}
@@ -3,18 +3,91 @@ package xml
 import (
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 )
 
 type parser struct {
 	*scanner
 	parsing string
+
+	charsetReader func(charset string, input io.Reader) (io.Reader, error)
+	// keep whitespace-only character data everywhere
+	keepWhitespace bool
+	// keep whitespace-only character data in the current element
+	preserveSpace bool
+	// record the source text needed to serialise the tree as it was read
+	lossless bool
+	// the input starts with a UTF-8 byte order mark to be recorded
+	bom bool
+	// namespaces in scope by prefix, nil unless resolving namespaces
+	namespaces map[string]string
+	maxSize    int64
+	maxDepth   int
+	// number of open elements
+	depth  int
+	strict bool
+
+	// replace references to general entities by their replacement text
+	expandEntities bool
+	// general entities declared in the DTD
+	entities map[string]*Entity
+	// names of the entities whose replacement text is being parsed
+	expanding       []string
+	expansionLimits ExpansionLimits
+	// text expanded in the whole parse, nil unless limiting it
+	expansion *expansion
+	// standalone="yes" in the XML declaration
+	standalone bool
+	// the DTD has declarations that may not have been read
+	externalDecls bool
+	// a reference to a parameter entity was not read; the declarations
+	// following it are not processed
+	unreadPERef bool
+	// replace references to parameter entities in the internal subset
+	expandPEs bool
+	// parameter entities declared in the DTD
+	paramEntities map[string]*Entity
+	// insert default attribute values and normalise attribute values
+	applyDefaults bool
+	// attribute definitions of the elements
+	attDefs attDefs
+
+	// opens external entities, nil unless loading them
+	resolver EntityResolver
+	// external entities that may be opened, nil to deny all
+	policy EntityPolicy
+	// URI of the resource being read
+	baseURI string
+	// URI of the resource each entity was declared in
+	bases map[*Entity]string
+	// reading external markup declarations, where parameter-entity
+	// references may occur within declarations
+	external bool
 }
 
 func (p *parser) error(err error) *XMLError {
 	return newErr(p.parsing, err, p.pos())
 }
 
+// fail makes err the result of the whole parse even if a caller backtracks,
+// and stops reading input.
+func (p *parser) fail(err error) error {
+	if p.err == nil {
+		p.err = err
+	}
+	p.reader = nil
+	return err
+}
+
+// span returns the Span from start to the current position.
+func (p *parser) span(start Pos) Span {
+	return Span{
+		Start: start,
+		End:   p.pos(),
+	}
+}
+
 func (p *parser) setParsing(new string) func() {
 	old := p.parsing
 	p.parsing = new
@@ -23,6 +96,41 @@ func (p *parser) setParsing(new string) func() {
 	}
 }
 
+// setXMLSpace applies the xml:space attribute among attrs to the content
+// of an element and returns a function restoring the enclosing setting.
+func (p *parser) setXMLSpace(attrs Attributes) func() {
+	old := p.preserveSpace
+	for _, a := range attrs {
+		if a.Name != "xml:space" || len(a.AttValue) != 1 {
+			continue
+		}
+		switch a.AttValue[0] {
+		case "preserve":
+			p.preserveSpace = true
+		case "default":
+			p.preserveSpace = p.keepWhitespace
+		}
+	}
+	return func() {
+		p.preserveSpace = old
+	}
+}
+
+// trivia returns the Trivia of the S Name Eq quoted-value pair that was
+// read from cur up to the cursor.
+func (p *parser) trivia(cur cursor) *Trivia {
+	pair := p.text(cur)
+	rest := strings.TrimLeft(pair, " \t\r\n")
+	space := pair[:len(pair)-len(rest)]
+	rest = rest[strings.IndexAny(rest, " \t\r\n="):]
+	value := strings.TrimLeft(rest, " \t\r\n=")
+	return &Trivia{
+		Space: space,
+		Eq:    rest[:len(rest)-len(value)],
+		Quote: rune(value[0]),
+	}
+}
+
 func (p *parser) Test(r rune) bool {
 	return p.Get() == r
 }
@@ -36,12 +144,12 @@ func (p *parser) Must(r rune) error {
 }
 
 func (p *parser) Tests(str string) bool {
-	i := int(p.cursor)
-	e := i + len([]rune(str))
-	if len(p.source) < e {
+	i := int(p.cursor.index)
+	e := i + len(str)
+	if !p.fill(e) {
 		return false
 	}
-	return string(p.source[i:e]) == str
+	return string(p.bytes(uint(i), uint(e))) == str
 }
 
 func (p *parser) Musts(str string) error {
@@ -59,7 +167,9 @@ func (p *parser) Musts(str string) error {
 
 // document ::= prolog element Misc*
 func (p *parser) parse() (*XML, error) {
-	var x XML
+	x := XML{
+		BOM: p.bom,
+	}
 	var err error
 	x.Prolog, err = p.parseProlog()
 	if err != nil {
@@ -69,6 +179,7 @@ func (p *parser) parse() (*XML, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer p.setParsing("Misc")()
 	for {
 		cur := p.cursor
 		var misc Misc
@@ -81,6 +192,9 @@ func (p *parser) parse() (*XML, error) {
 			x.Misc = append(x.Misc, misc)
 		}
 	}
+	if p.strict && !p.isEnd() {
+		return nil, p.error(errors.New("unexpected content after the document element"))
+	}
 	return &x, nil
 }
 
@@ -90,7 +204,9 @@ func (p *parser) parse() (*XML, error) {
 func (p *parser) parseProlog() (*Prolog, error) {
 	pro := Prolog{}
 
-	p.skipSpace()
+	if !p.lossless && !p.strict {
+		p.skipSpace()
+	}
 
 	if p.Tests("<?xml") {
 		xmlDecl, err := p.parseXmlDecl()
@@ -138,19 +254,25 @@ func (p *parser) parseProlog() (*Prolog, error) {
 func (p *parser) parseXmlDecl() (*XMLDecl, error) {
 	defer p.setParsing("XML Declaration")()
 
+	start := p.pos()
 	if err := p.Musts("<?xml"); err != nil {
 		return nil, err
 	}
 	x := XMLDecl{}
 
+	// keep cursor at this time
+	cur := p.cursor
+
 	ver, err := p.parseVersion()
 	if err != nil {
 		return nil, err
 	}
 	x.Version = ver
+	if p.lossless {
+		x.VersionTrivia = p.trivia(cur)
+	}
 
-	// keep cursor at this time
-	cur := p.cursor
+	cur = p.cursor
 
 	p.skipSpace()
 
@@ -163,6 +285,9 @@ func (p *parser) parseXmlDecl() (*XMLDecl, error) {
 			return nil, err
 		}
 		x.Encoding = enc
+		if p.lossless {
+			x.EncodingTrivia = p.trivia(cur)
+		}
 	} else {
 		p.cursor = cur
 	}
@@ -179,14 +304,23 @@ func (p *parser) parseXmlDecl() (*XMLDecl, error) {
 			return nil, err
 		}
 		x.Standalone = std
+		p.standalone = std
+		if p.lossless {
+			x.StandaloneTrivia = p.trivia(cur)
+		}
 	} else {
 		p.cursor = cur
 	}
 
+	cur = p.cursor
 	p.skipSpace()
+	if p.lossless {
+		x.Space = p.text(cur)
+	}
 	if err := p.Musts("?>"); err != nil {
 		return nil, err
 	}
+	x.Span = p.span(start)
 
 	return &x, nil
 }
@@ -244,24 +378,21 @@ func (p *parser) parseVersionNum() (string, error) {
 		}
 	}
 
-	var str string
+	start := p.cursor
 	r, ok := isVerChar()
 	if !ok {
 		return "", p.error(fmt.Errorf("unexpected version number character '%c'", r))
 	}
-	str += string(r)
 	p.Step()
 
 	for {
-		r, ok := isVerChar()
-		if !ok {
+		if _, ok := isVerChar(); !ok {
 			break
 		}
-		str += string(r)
 		p.Step()
 	}
 
-	return str, nil
+	return p.text(start), nil
 }
 
 // Misc ::= Comment | PI | S
@@ -279,7 +410,14 @@ func (p *parser) parseMisc() (Misc, error) {
 		}
 		return pi, err
 	} else if isSpace(p.Get()) {
+		start, cur := p.pos(), p.cursor
 		p.skipSpace()
+		if p.lossless {
+			return &Space{
+				Value: p.text(cur),
+				Span:  p.span(start),
+			}, nil
+		}
 		return nil, nil
 	} else {
 		return nil, p.error(fmt.Errorf("unknown misc type"))
@@ -313,18 +451,16 @@ func (p *parser) isNameChar() bool {
 
 // Name ::= (Letter | '_' | ':') (NameChar)*
 func (p *parser) parseName() (string, error) {
-	var n string
+	start := p.cursor
 	if isLetter(p.Get()) || p.Test('_') || p.Test(':') {
-		n += string(p.Get())
 		p.Step()
 	} else {
 		return "", p.error(errors.New("invalid letter for name"))
 	}
 	for p.isNameChar() {
-		n += string(p.Get())
 		p.Step()
 	}
-	return n, nil
+	return p.text(start), nil
 }
 
 /// - Literals
@@ -336,10 +472,28 @@ func (p *parser) parseEntityValue() (EntityValue, error) {
 	if quote, err = p.parseQuote(); err != nil {
 		return nil, err
 	}
+	res, err := p.parseEntityChars(quote)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.Must(quote); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
 
+// parseEntityChars parses ([^%&"] | PEReference | Reference)* up to quote
+// or the end of input.
+func (p *parser) parseEntityChars(quote rune) (EntityValue, error) {
+	var err error
 	res := EntityValue{}
 
-	var str string
+	start := p.cursor
+	flush := func() {
+		if p.cursor.index > start.index {
+			res = append(res, p.text(start))
+		}
+	}
 	for {
 		if p.Test(quote) || p.isEnd() {
 			break
@@ -348,10 +502,7 @@ func (p *parser) parseEntityValue() (EntityValue, error) {
 		cur := p.cursor
 
 		if p.Test('&') {
-			if len(str) > 0 {
-				res = append(res, str)
-				str = ""
-			}
+			flush()
 
 			// try EntityRef
 			var eRef *EntityRef
@@ -368,32 +519,21 @@ func (p *parser) parseEntityValue() (EntityValue, error) {
 			} else {
 				res = append(res, eRef)
 			}
+			start = p.cursor
 		} else if p.Test('%') {
-			if len(str) > 0 {
-				res = append(res, str)
-				str = ""
-			}
+			flush()
 
 			var pRef *PERef
 			if pRef, err = p.parsePERef(); err != nil {
 				return nil, err
 			}
 			res = append(res, pRef)
+			start = p.cursor
 		} else {
-			str += string(p.Get())
 			p.Step()
 		}
 	}
-
-	if len(str) > 0 {
-		res = append(res, str)
-		str = ""
-	}
-
-	if err = p.Must(quote); err != nil {
-		return nil, err
-	}
-
+	flush()
 	return res, nil
 }
 
@@ -405,9 +545,28 @@ func (p *parser) parseAttValue() (AttValue, error) {
 		return nil, err
 	}
 
+	res, err := p.parseAttChars(quote)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = p.Must(quote); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// parseAttChars parses ([^<&"] | Reference)* up to quote or the end of input.
+func (p *parser) parseAttChars(quote rune) (AttValue, error) {
 	res := AttValue{}
 
-	var str string
+	start := p.cursor
+	flush := func() {
+		if p.cursor.index > start.index {
+			res = append(res, p.text(start))
+		}
+	}
 	for {
 		if p.Test('<') {
 			return nil, p.error(fmt.Errorf("unexpected '<'"))
@@ -417,31 +576,19 @@ func (p *parser) parseAttValue() (AttValue, error) {
 		}
 
 		if p.Test('&') {
-			if len(str) > 0 {
-				res = append(res, str)
-				str = ""
-			}
+			flush()
 
-			var ref Ref
-			if ref, err = p.parseReference(); err != nil {
+			ref, err := p.parseReference()
+			if err != nil {
 				return nil, err
 			}
 			res = append(res, ref)
+			start = p.cursor
 		} else {
-			str += string(p.Get())
 			p.Step()
 		}
 	}
-
-	if len(str) > 0 {
-		res = append(res, str)
-		str = ""
-	}
-
-	if err = p.Must(quote); err != nil {
-		return nil, err
-	}
-
+	flush()
 	return res, nil
 }
 
@@ -453,15 +600,15 @@ func (p *parser) parseSystemLiteral() (string, error) {
 		return "", err
 	}
 
-	var lit string
+	start := p.cursor
 	for !p.Test(quote) {
-		lit += string(p.Get())
 		p.Step()
 
 		if p.isEnd() {
 			return "", p.error(fmt.Errorf("could not find quote %c", quote))
 		}
 	}
+	lit := p.text(start)
 	p.Step()
 
 	return lit, nil
@@ -475,16 +622,16 @@ func (p *parser) parsePubidLiteral() (string, error) {
 		return "", err
 	}
 
-	var lit string
+	start := p.cursor
 	r := p.Get()
 	for isPubidChar(r) {
 		if r == '\'' && quote == '\'' {
 			break
 		}
-		lit += string(r)
 		p.Step()
 		r = p.Get()
 	}
+	lit := p.text(start)
 
 	if err = p.Must(quote); err != nil {
 		return "", err
@@ -496,29 +643,32 @@ func (p *parser) parsePubidLiteral() (string, error) {
 /// - Comments
 
 // Comment ::= '<!--' ((Char - '-') | ('-' (Char - '-')))* '-->'
-func (p *parser) parseComment() (Comment, error) {
+func (p *parser) parseComment() (*Comment, error) {
 	defer p.setParsing("Comment")()
 
+	start := p.pos()
 	if err := p.Musts(`<!--`); err != nil {
-		return "", err
+		return nil, err
 	}
 
-	var str Comment
+	from := p.cursor
 	for !p.Tests("--") {
-		r := p.Get()
-		if isChar(r) {
-			str += Comment(r)
+		if isChar(p.Get()) {
 			p.Step()
 		} else {
-			return "", p.error(errors.New("unexpected character"))
+			return nil, p.error(errors.New("unexpected character"))
 		}
 	}
+	str := p.text(from)
 
 	if err := p.Musts(`-->`); err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return str, nil
+	return &Comment{
+		Value: str,
+		Span:  p.span(start),
+	}, nil
 }
 
 /// - Processing Instructions
@@ -528,6 +678,7 @@ func (p *parser) parsePI() (*PI, error) {
 	defer p.setParsing("NOTATION")()
 
 	var err error
+	start := p.pos()
 	if err = p.Musts("<?"); err != nil {
 		return nil, err
 	}
@@ -537,17 +688,23 @@ func (p *parser) parsePI() (*PI, error) {
 	}
 
 	if isSpace(p.Get()) {
+		cur := p.cursor
 		p.skipSpace()
+		if p.lossless {
+			pi.Space = p.text(cur)
+		}
 
+		from := p.cursor
 		for !p.Tests("?>") && !p.isEnd() && isChar(p.Get()) {
-			pi.Instruction += string(p.Get())
 			p.Step()
 		}
+		pi.Instruction = p.text(from)
 	}
 
 	if err = p.Musts("?>"); err != nil {
 		return nil, err
 	}
+	pi.Span = p.span(start)
 	return &pi, nil
 }
 
@@ -567,21 +724,25 @@ func (p *parser) parsePITarget() (string, error) {
 /// - CDATA Sections
 
 // CDSect ::= CDStart CData CDEnd
-func (p *parser) parseCDSect() (CData, error) {
+func (p *parser) parseCDSect() (*CData, error) {
 	var err error
+	start := p.pos()
 	if err = p.Musts("<![CDATA["); err != nil {
-		return "", err
+		return nil, err
 	}
-	var str string
+	from := p.cursor
 	for !p.Tests("]]>") {
 		if p.isEnd() {
-			return "", p.error(errors.New("not found CDSect close tag"))
+			return nil, p.error(errors.New("not found CDSect close tag"))
 		}
-		str += string(p.Get())
 		p.Step()
 	}
+	str := p.text(from)
 	p.StepN(len("]]>"))
-	return CData(str), nil
+	return &CData{
+		Value: str,
+		Span:  p.span(start),
+	}, nil
 }
 
 /// - Document Type Definition
@@ -591,6 +752,7 @@ func (p *parser) parseDoctype() (*DOCType, error) {
 	defer p.setParsing("DOCTYPE")()
 
 	var err error
+	start, from := p.pos(), p.cursor
 	if err = p.Musts(`<!DOCTYPE`); err != nil {
 		return nil, err
 	}
@@ -616,29 +778,14 @@ func (p *parser) parseDoctype() (*DOCType, error) {
 		p.skipSpace()
 	}
 
+	p.startDTD()
+
 	if p.Test('[') {
 		p.Step()
 
-		for {
-			if p.Tests("<!ELEMENT") || p.Tests("<!ATTLIST") || p.Tests("<!ENTITY") || p.Tests("<!NOTATION") || p.Tests("<?") || p.Tests("<!--") {
-				var m Markup
-				m, err = p.parseMarkup()
-				if err != nil {
-					return nil, err
-				}
-				d.Markups = append(d.Markups, m)
-			} else if p.Test('%') {
-				var ref *PERef
-				ref, err = p.parsePERef()
-				if err != nil {
-					return nil, err
-				}
-				d.PERef = ref
-			} else if isSpace(p.Get()) {
-				p.skipSpace()
-			} else {
-				break
-			}
+		d.Markups, err = p.parseIntSubset(nil)
+		if err != nil {
+			return nil, err
 		}
 		err = p.Must(']')
 		if err != nil {
@@ -652,10 +799,298 @@ func (p *parser) parseDoctype() (*DOCType, error) {
 	if err != nil {
 		return nil, err
 	}
+	d.Span = p.span(start)
+	if p.lossless {
+		d.Raw = p.text(from)
+	}
+	if d.ExtID != nil {
+		p.externalDecls = true
+		if p.resolver != nil {
+			if d.ExtSubset, err = p.loadExtSubset(d.ExtID, d.Markups); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &d, nil
+}
+
+// startDTD prepares to record the declarations of a DTD.
+func (p *parser) startDTD() {
+	p.entities = map[string]*Entity{}
+	p.paramEntities = map[string]*Entity{}
+	p.attDefs = newAttDefs()
+	p.unreadPERef = false
+	if p.resolver != nil {
+		p.bases = map[*Entity]string{}
+	}
+}
+
+// intSubset ::= (markupdecl | DeclSep)*
+// DeclSep ::= PEReference | S
+//
+// parseIntSubset appends the declarations read to markups.
+func (p *parser) parseIntSubset(markups []Markup) ([]Markup, error) {
+	for {
+		switch {
+		case p.Tests("<!ELEMENT") || p.Tests("<!ATTLIST") || p.Tests("<!ENTITY") || p.Tests("<!NOTATION") || p.Tests("<?") || p.Tests("<!--"):
+			var m Markup
+			var err error
+			if p.external && p.expandPEs && !p.Tests("<?") && !p.Tests("<!--") {
+				m, err = p.parseExtMarkup()
+			} else {
+				cur := p.cursor
+				if m, err = p.parseMarkup(); err != nil {
+					p.cursor = cur
+					if ref := p.declPERef(); ref != nil {
+						err = p.declPERefError(ref)
+					}
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+			switch m := m.(type) {
+			case *Entity:
+				if p.external && p.expandPEs && m.ExtID == nil {
+					var refs []*PERef
+					if m.Value, refs, err = p.includePERefs(m.Value); err != nil {
+						return nil, err
+					}
+					m.PERefs = append(m.PERefs, refs...)
+				}
+				p.bind(m)
+			case *Attlist:
+				p.bindAttlist(m)
+			}
+			markups = append(markups, m)
+		case p.external && p.Tests("<!["):
+			c, err := p.parseCondSect(markups)
+			if err != nil {
+				return nil, err
+			}
+			markups = append(markups, c)
+		case p.Test('%'):
+			ref, err := p.parsePERef()
+			if err != nil {
+				return nil, err
+			}
+			p.externalDecls = true
+			if !p.expandPEs {
+				p.unreadPERef = true
+				markups = append(markups, ref)
+				continue
+			}
+			markups, err = p.expandPERef(ref, markups)
+			if err != nil {
+				return nil, err
+			}
+		case isSpace(p.Get()):
+			p.skipSpace()
+		default:
+			return markups, nil
+		}
+	}
+}
+
+// extSubset ::= TextDecl? extSubsetDecl
+func (p *parser) parseExtSubset() (*DTD, error) {
+	defer p.setParsing("DTD")()
 
+	start := p.pos()
+	var d DTD
+	var err error
+	if p.atXMLDecl() {
+		if d.TextDecl, err = p.parseTextDecl(); err != nil {
+			return nil, err
+		}
+	}
+	p.startDTD()
+	p.external = true
+	if d.Markups, err = p.parseDecls(nil); err != nil {
+		return nil, err
+	}
+	d.Span = p.span(start)
 	return &d, nil
 }
 
+// conditionalSect ::= includeSect | ignoreSect
+// includeSect ::= '<![' S? 'INCLUDE' S? '[' extSubsetDecl ']]>'
+// ignoreSect ::= '<![' S? 'IGNORE' S? '[' ignoreSectContents* ']]>'
+//
+// parseCondSect parses a conditional section following markups.
+func (p *parser) parseCondSect(markups []Markup) (*CondSect, error) {
+	defer p.setParsing("conditional section")()
+
+	start := p.pos()
+	if err := p.Musts("<!["); err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	var c CondSect
+	var err error
+	switch {
+	case p.Tests("INCLUDE"):
+		c.Keyword = "INCLUDE"
+	case p.Tests("IGNORE"):
+		c.Keyword = "IGNORE"
+	case p.Test('%'):
+		if c.KeywordRef, err = p.parsePERef(); err != nil {
+			return nil, err
+		}
+		if p.expandPEs {
+			var text string
+			if text, err = p.declPERefText(c.KeywordRef); err != nil {
+				return nil, err
+			}
+			c.Keyword = strings.TrimFunc(text, isSpace)
+			if c.Keyword != "INCLUDE" && c.Keyword != "IGNORE" {
+				return nil, newErr(p.parsing, fmt.Errorf("parameter entity %q is not INCLUDE or IGNORE", c.KeywordRef.Name), c.KeywordRef.Start)
+			}
+		} else {
+			p.unreadPERef = true
+		}
+	default:
+		return nil, p.error(errors.New("expected INCLUDE or IGNORE"))
+	}
+	if c.KeywordRef == nil {
+		p.StepN(len(c.Keyword))
+	}
+	p.skipSpace()
+	if err = p.Must('['); err != nil {
+		return nil, err
+	}
+
+	if c.Keyword == "INCLUDE" {
+		n := len(markups)
+		if markups, err = p.parseIntSubset(markups[:n:n]); err != nil {
+			return nil, err
+		}
+		c.Markups = markups[n:]
+	} else {
+		// ignoreSectContents ::= Ignore ('<![' ignoreSectContents ']]>' Ignore)*
+		from := p.cursor
+		for depth := 0; depth > 0 || !p.Tests("]]>"); {
+			switch {
+			case p.isEnd():
+				return nil, p.error(errors.New("could not find ']]>'"))
+			case p.Tests("<!["):
+				depth++
+				p.StepN(len("<!["))
+			case p.Tests("]]>"):
+				depth--
+				p.StepN(len("]]>"))
+			default:
+				p.Step()
+			}
+		}
+		c.Ignored = p.text(from)
+	}
+	if err = p.Musts("]]>"); err != nil {
+		return nil, err
+	}
+	c.Span = p.span(start)
+	return &c, nil
+}
+
+// parseDecls parses the rest of the input as a sequence of markup
+// declarations, appending them to markups.
+func (p *parser) parseDecls(markups []Markup) ([]Markup, error) {
+	markups, err := p.parseIntSubset(markups)
+	if err == nil && p.err == nil && !p.isEnd() {
+		err = p.error(errors.New("expected markup declaration"))
+	}
+	if p.err != nil {
+		err = p.err
+	}
+	return markups, err
+}
+
+// parseExtMarkup parses a markup declaration in external markup after
+// replacing the references to parameter entities in it.
+func (p *parser) parseExtMarkup() (Markup, error) {
+	from := p.cursor
+	var quote rune
+	for !p.isEnd() && (quote != 0 || !p.Test('>')) {
+		switch r := p.Get(); {
+		case r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		}
+		p.Step()
+	}
+	p.Step()
+	text, refs, err := p.expandDeclPERefs(p.text(from), from)
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		p.cursor = from
+		return p.parseMarkup()
+	}
+
+	start := from.pos()
+	sub := *p
+	sub.scanner = &scanner{
+		source: []byte(text),
+	}
+	m, err := sub.parseMarkup()
+	if err == nil && !sub.isEnd() {
+		err = sub.error(errors.New("declaration is not well-formed after replacing parameter entities"))
+	}
+	if err != nil {
+		return nil, newErr(p.parsing, fmt.Errorf("in declaration with parameter entities: %w", err), start)
+	}
+	// the declaration is read from its text with the references replaced
+	moveDeclSpans([]Markup{m}, p.span(start))
+	switch m := m.(type) {
+	case *ElementDecl:
+		m.PERefs = refs
+	case *Attlist:
+		m.PERefs = refs
+	case *Entity:
+		m.PERefs = refs
+	case *Notation:
+		m.PERefs = refs
+	}
+	return m, nil
+}
+
+// declPERef returns the first reference to a parameter entity outside
+// literals in the markup declaration at the cursor, or nil.
+func (p *parser) declPERef() *PERef {
+	cur := p.cursor
+	defer func() {
+		p.cursor = cur
+	}()
+	var quote rune
+	for !p.isEnd() && (quote != 0 || !p.Test('>')) {
+		switch r := p.Get(); {
+		case r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == '%' && p.atPERef():
+			if ref, err := p.parsePERef(); err == nil {
+				return ref
+			}
+		}
+		p.Step()
+	}
+	return nil
+}
+
+// declPERefError reports ref, found within a markup declaration that
+// is read without replacing it.
+func (p *parser) declPERefError(ref *PERef) error {
+	if p.external {
+		return newErr(p.parsing, fmt.Errorf("parameter entity %q within a markup declaration is only read with ExpandParameterEntities", ref.Name), ref.Start)
+	}
+	// WFC: PEs in Internal Subset
+	return newErr(p.parsing, fmt.Errorf("parameter entity %q is referred to within a markup declaration of the internal subset", ref.Name), ref.Start)
+}
+
 // markupdecl ::= elementdecl | AttlistDecl | EntityDecl | NotationDecl | PI | Comment
 func (p *parser) parseMarkup() (Markup, error) {
 	defer p.setParsing("markup")()
@@ -717,12 +1152,62 @@ func (p *parser) parseStandalone() (bool, error) {
 /// - Element
 
 // element ::= EmptyElemTag | STag content ETag
-// EmptyElemTag ::= '<' Name (S Attribute)* S? '/>'
-// STag ::= '<' Name (S Attribute)* S? '>'
 func (p *parser) parseElement() (*Element, error) {
 	defer p.setParsing("Element")()
 
+	if p.maxDepth > 0 && p.depth >= p.maxDepth {
+		return nil, p.fail(p.error(ErrDepthLimit))
+	}
+	p.depth++
+	defer func() {
+		p.depth--
+	}()
+
+	e, err := p.parseSTag()
+	if err != nil {
+		return nil, err
+	}
+	restore, err := p.setNamespaces(e)
+	if err != nil {
+		return nil, p.fail(err)
+	}
+	defer restore()
+	if e.IsEmptyTag {
+		return e, nil
+	}
+	defer p.setParsing(e.Name + " tag")()
+	defer p.setXMLSpace(e.Attrs)()
+
+	e.Contents = p.parseContents()
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	// the input before the content may have been discarded, so that the
+	// element cannot be read again from its start
+	start, cur := p.pos(), p.cursor
+	var endName string
+	if endName, err = p.parseETag(); err != nil {
+		return nil, p.fail(err)
+	}
+	if endName != e.Name {
+		return nil, p.fail(p.error(fmt.Errorf("EndTag name %q does not match with StartTag name %q", endName, e.Name)))
+	}
+	if p.lossless {
+		// ETag ::= '</' Name S? '>'
+		tag := p.text(cur)
+		e.ETagSpace = tag[len("</")+len(endName) : len(tag)-len(">")]
+	}
+	e.ETag = p.span(start)
+	e.Span.End = e.ETag.End
+	return e, nil
+}
+
+// EmptyElemTag ::= '<' Name (S Attribute)* S? '/>'
+// STag ::= '<' Name (S Attribute)* S? '>'
+func (p *parser) parseSTag() (*Element, error) {
 	var err error
+	start := p.pos()
 	if err = p.Must('<'); err != nil {
 		return nil, err
 	}
@@ -734,8 +1219,12 @@ func (p *parser) parseElement() (*Element, error) {
 	defer p.setParsing(e.Name + " tag")()
 
 	for isSpace(p.Get()) {
+		cur := p.cursor
 		p.skipSpace()
 		if p.Test('>') || p.Tests("/>") || p.isEnd() {
+			if p.lossless {
+				e.STagSpace = p.text(cur)
+			}
 			break
 		}
 
@@ -743,27 +1232,35 @@ func (p *parser) parseElement() (*Element, error) {
 		if attr, err = p.parseAttribute(); err != nil {
 			return nil, err
 		}
+		if p.lossless {
+			attr.Trivia = *p.trivia(cur)
+		}
+		if p.strict {
+			// WFC: Unique Att Spec
+			for _, a := range e.Attrs {
+				if a.Name == attr.Name {
+					return nil, p.fail(newErr(p.parsing, fmt.Errorf("attribute %q is specified twice", attr.Name), attr.Span.Start))
+				}
+			}
+		}
 		e.Attrs = append(e.Attrs, attr)
 	}
 
 	if p.Test('>') {
 		p.Step()
-
-		e.Contents = p.parseContents()
-
-		var endName string
-		if endName, err = p.parseETag(); err != nil {
-			return nil, err
-		}
-		if endName != e.Name {
-			return nil, p.error(fmt.Errorf("EndTag name %q does not match with StartTag name %q", endName, e.Name))
-		}
 	} else if p.Tests("/>") {
 		p.StepN(len("/>"))
 		e.IsEmptyTag = true
 	} else {
 		return nil, p.error(errors.New("not found element close tag"))
 	}
+	e.STag = p.span(start)
+	e.Span = e.STag
+	if p.applyDefaults {
+		if err = p.applyAttDefs(&e); err != nil {
+			return nil, p.fail(err)
+		}
+	}
 	return &e, nil
 }
 
@@ -771,15 +1268,25 @@ func (p *parser) parseElement() (*Element, error) {
 func (p *parser) parseAttribute() (*Attribute, error) {
 	var attr Attribute
 	var err error
+	start := p.pos()
 	if attr.Name, err = p.parseName(); err != nil {
 		return nil, err
 	}
+	attr.NameSpan = p.span(start)
 	if err = p.parseEq(); err != nil {
 		return nil, err
 	}
+	valueStart := p.pos()
 	if attr.AttValue, err = p.parseAttValue(); err != nil {
 		return nil, err
 	}
+	attr.ValueSpan = p.span(valueStart)
+	if p.expandEntities {
+		if attr.AttValue, err = p.expandAttValue(attr.AttValue); err != nil {
+			return nil, p.fail(err)
+		}
+	}
+	attr.Span = p.span(start)
 	return &attr, nil
 }
 
@@ -805,7 +1312,7 @@ func (p *parser) parseETag() (string, error) {
 /// - Content of Elements
 
 func isOnlySpaces(str string) bool {
-	for _, r := range []rune(str) {
+	for _, r := range str {
 		if !isSpace(r) {
 			return false
 		}
@@ -814,7 +1321,35 @@ func isOnlySpaces(str string) bool {
 }
 
 // content ::= (element | CharData | Reference | CDSect | PI | Comment)*
+//
+// Character data consisting only of white space is dropped unless it is preserved.
 func (p *parser) parseContents() []interface{} {
+	res := p.parseContent()
+	if p.preserveSpace {
+		return res
+	}
+	return dropSpaces(res)
+}
+
+// dropSpaces removes the character data consisting only of white space
+// from items.
+func dropSpaces(items []interface{}) []interface{} {
+	n := 0
+	for _, c := range items {
+		if v, ok := c.(*CharData); ok && isOnlySpaces(v.Value) {
+			continue
+		}
+		items[n] = c
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	return items[:n]
+}
+
+// parseContent parses content keeping all character data.
+func (p *parser) parseContent() []interface{} {
 	// '<'Name 			-> Element
 	// '&'Name or '&#'	-> Ref
 	// '<![CDATA['		-> CDSect
@@ -827,12 +1362,36 @@ func (p *parser) parseContents() []interface{} {
 	var res []interface{}
 	var err error
 
-	var charData string
+	// range of the pending character data
+	var inCharData bool
+	var charStart, charEnd cursor
 	var i interface{}
 
+	flush := func() {
+		if inCharData {
+			res = append(res, &CharData{
+				Value: string(p.bytes(charStart.index, charEnd.index)),
+				Span: Span{
+					Start: charStart.pos(),
+					End:   charEnd.pos(),
+				},
+			})
+			inCharData = false
+		}
+	}
+
 	for {
+		if !inCharData {
+			// no cursor before this one is restored: a failure after the
+			// content of a child element was read is fatal
+			p.discard()
+		}
 		cur := p.cursor
 
+		if inCharData && (p.Test('&') || p.Test('<') || p.isEnd() || p.Tests("]]>")) {
+			charEnd = p.cursor
+		}
+
 		if p.Test('&') {
 			// Ref or break
 			i, err = p.parseReference()
@@ -840,13 +1399,17 @@ func (p *parser) parseContents() []interface{} {
 				p.cursor = cur
 				break
 			}
-			if len(charData) > 0 {
-				if !isOnlySpaces(charData) {
-					res = append(res, charData)
+			flush()
+			if ref, ok := i.(*EntityRef); ok && p.expandEntities {
+				items, err := p.expandContent(ref)
+				if err != nil {
+					p.fail(err)
+					break
 				}
-				charData = ""
+				res = append(res, items...)
+			} else {
+				res = append(res, i)
 			}
-			res = append(res, i)
 		} else if p.Test('<') {
 			if p.Tests("<!") {
 				// CDSect or Comment or break
@@ -869,18 +1432,16 @@ func (p *parser) parseContents() []interface{} {
 				}
 			} else {
 				// Element or break
+				flush()
 				i, err = p.parseElement()
 				if err != nil {
-					p.cursor = cur
+					if p.err == nil {
+						p.cursor = cur
+					}
 					break
 				}
 			}
-			if len(charData) > 0 {
-				if !isOnlySpaces(charData) {
-					res = append(res, charData)
-				}
-				charData = ""
-			}
+			flush()
 			res = append(res, i)
 		} else {
 			if p.isEnd() || p.Tests("]]>") {
@@ -888,16 +1449,15 @@ func (p *parser) parseContents() []interface{} {
 			}
 
 			// CharData
-			charData += string(p.Get())
+			if !inCharData {
+				charStart = p.cursor
+				inCharData = true
+			}
 			p.Step()
 		}
 	}
-	if len(charData) > 0 {
-		if !isOnlySpaces(charData) {
-			res = append(res, charData)
-		}
-	}
-	return res
+	flush()
+	return joinContent(res)
 }
 
 /// - Element Type Declaration
@@ -907,6 +1467,7 @@ func (p *parser) parseElementDecl() (*ElementDecl, error) {
 	defer p.setParsing("Element Declaration")()
 
 	var err error
+	start := p.pos()
 	if err = p.Musts("<!ELEMENT"); err != nil {
 		return nil, err
 	}
@@ -931,17 +1492,19 @@ func (p *parser) parseElementDecl() (*ElementDecl, error) {
 	return &ElementDecl{
 		Name:        n,
 		ContentSpec: c,
+		Span:        p.span(start),
 	}, nil
 }
 
 // contentspec ::= 'EMPTY' | 'ANY' | Mixed | children
 func (p *parser) parseContentSpec() (ContentSpec, error) {
+	start := p.pos()
 	if p.Tests("EMPTY") {
 		p.StepN(len("EMPTY"))
-		return &EMPTY{}, nil
+		return &EMPTY{Span: p.span(start)}, nil
 	} else if p.Tests("ANY") {
 		p.StepN(len("ANY"))
-		return &ANY{}, nil
+		return &ANY{Span: p.span(start)}, nil
 	} else {
 		var err error
 
@@ -972,6 +1535,7 @@ func (p *parser) parseChildren() (*Children, error) {
 	var c Children
 	var err error
 
+	start := p.pos()
 	cur := p.cursor
 	{
 		var choice *Choice
@@ -983,6 +1547,7 @@ func (p *parser) parseChildren() (*Children, error) {
 				c.Suffix = &r
 				p.Step()
 			}
+			c.Span = p.span(start)
 			return &c, nil
 		}
 	}
@@ -997,6 +1562,7 @@ func (p *parser) parseChildren() (*Children, error) {
 			c.Suffix = &r
 			p.Step()
 		}
+		c.Span = p.span(start)
 		return &c, nil
 	}
 
@@ -1007,6 +1573,7 @@ func (p *parser) parseChildren() (*Children, error) {
 func (p *parser) parseCP() (*CP, error) {
 	var cp CP
 	var err error
+	start := p.pos()
 	if p.Test('(') { // choice or seq
 		cur := p.cursor
 
@@ -1038,12 +1605,14 @@ func (p *parser) parseCP() (*CP, error) {
 		cp.Suffix = &r
 		p.Step()
 	}
+	cp.Span = p.span(start)
 
 	return &cp, nil
 }
 
 // choice ::= '(' S? cp ( S? '|' S? cp )* S? ')'
 func (p *parser) parseChoice() (*Choice, error) {
+	start := p.pos()
 	if err := p.Must('('); err != nil {
 		return nil, err
 	}
@@ -1060,6 +1629,7 @@ func (p *parser) parseChoice() (*Choice, error) {
 			break
 		}
 		p.Step()
+		p.skipSpace()
 
 		cp, err = p.parseCP()
 		if err != nil {
@@ -1071,12 +1641,14 @@ func (p *parser) parseChoice() (*Choice, error) {
 		return nil, err
 	}
 	return &Choice{
-		CPs: cps,
+		CPs:  cps,
+		Span: p.span(start),
 	}, nil
 }
 
 // seq ::= '(' S? cp ( S? ',' S? cp )* S? ')'
 func (p *parser) parseSeq() (*Seq, error) {
+	start := p.pos()
 	if err := p.Must('('); err != nil {
 		return nil, err
 	}
@@ -1094,6 +1666,7 @@ func (p *parser) parseSeq() (*Seq, error) {
 			break
 		}
 		p.Step()
+		p.skipSpace()
 
 		cp, err = p.parseCP()
 		if err != nil {
@@ -1106,7 +1679,8 @@ func (p *parser) parseSeq() (*Seq, error) {
 		return nil, err
 	}
 	return &Seq{
-		CPs: cps,
+		CPs:  cps,
+		Span: p.span(start),
 	}, nil
 }
 
@@ -1114,6 +1688,7 @@ func (p *parser) parseSeq() (*Seq, error) {
 
 // Mixed ::= '(' S? '#PCDATA' (S? '|' S? Name)* S? ')*' | '(' S? '#PCDATA' S? ')'
 func (p *parser) parseMixed() (*Mixed, error) {
+	start := p.pos()
 	if err := p.Must('('); err != nil {
 		return nil, err
 	}
@@ -1150,6 +1725,7 @@ func (p *parser) parseMixed() (*Mixed, error) {
 			return nil, err
 		}
 	}
+	m.Span = p.span(start)
 
 	return &m, nil
 }
@@ -1162,6 +1738,7 @@ func (p *parser) parseAttlist() (*Attlist, error) {
 
 	var att Attlist
 	var err error
+	start := p.pos()
 	if err = p.Musts("<!ATTLIST"); err != nil {
 		return nil, err
 	}
@@ -1191,6 +1768,7 @@ func (p *parser) parseAttlist() (*Attlist, error) {
 		}
 		att.Defs = append(att.Defs, def)
 	}
+	att.Span = p.span(start)
 
 	return &att, nil
 }
@@ -1203,6 +1781,7 @@ func (p *parser) parseAttDef() (*AttDef, error) {
 	}
 
 	var def AttDef
+	start := p.pos()
 	if def.Name, err = p.parseName(); err != nil {
 		return nil, err
 	}
@@ -1222,6 +1801,7 @@ func (p *parser) parseAttDef() (*AttDef, error) {
 	if def.Decl, err = p.parseDefaultDecl(); err != nil {
 		return nil, err
 	}
+	def.Span = p.span(start)
 
 	return &def, nil
 }
@@ -1269,6 +1849,7 @@ func (p *parser) parseAttType() (AttType, error) {
 // NotationType ::= 'NOTATION' S '(' S? Name (S? '|' S? Name)* S? ')'
 func (p *parser) parseNotationType() (*NotationType, error) {
 	var err error
+	start := p.pos()
 	if err = p.Musts("NOTATION"); err != nil {
 		return nil, err
 	}
@@ -1311,6 +1892,7 @@ func (p *parser) parseNotationType() (*NotationType, error) {
 		}
 		n.Names = append(n.Names, t)
 	}
+	n.Span = p.span(start)
 
 	return &n, nil
 }
@@ -1320,6 +1902,7 @@ func (p *parser) parseEnum() (*Enum, error) {
 	var err error
 	var e Enum
 
+	start := p.pos()
 	if err = p.Must('('); err != nil {
 		return nil, err
 	}
@@ -1355,19 +1938,18 @@ func (p *parser) parseEnum() (*Enum, error) {
 		}
 		e.Cases = append(e.Cases, nm)
 	}
+	e.Span = p.span(start)
 
 	return &e, nil
 }
 
 // Nmtoken ::= (NameChar)+
 func (p *parser) parseNmtoken() (string, error) {
-	var str string
-	r := p.Get()
-	for isNameChar(r) {
-		str += string(r)
+	start := p.cursor
+	for isNameChar(p.Get()) {
 		p.Step()
-		r = p.Get()
 	}
+	str := p.text(start)
 	if len(str) == 0 {
 		return "", p.error(errors.New("empty Nmtoken"))
 	}
@@ -1380,25 +1962,30 @@ func (p *parser) parseNmtoken() (string, error) {
 func (p *parser) parseDefaultDecl() (*DefaultDecl, error) {
 	var d DefaultDecl
 	var err error
+	start := p.pos()
 	if p.Tests(DefaultDeclTypeRequired.ToString()) {
 		p.StepN(len(DefaultDeclTypeRequired.ToString()))
 		d.Type = DefaultDeclTypeRequired
+		d.Span = p.span(start)
 		return &d, nil
 	} else if p.Tests(DefaultDeclTypeImplied.ToString()) {
 		p.StepN(len(DefaultDeclTypeImplied.ToString()))
 		d.Type = DefaultDeclTypeImplied
+		d.Span = p.span(start)
 		return &d, nil
 	} else {
+		d.Type = DefaultDeclTypeValue
 		if p.Tests(DefaultDeclTypeFixed.ToString()) {
 			p.StepN(len(DefaultDeclTypeFixed.ToString()))
 			if err = p.parseSpace(); err != nil {
 				return nil, err
 			}
+			d.Type = DefaultDeclTypeFixed
 		}
-		d.Type = DefaultDeclTypeFixed
 		if d.AttValue, err = p.parseAttValue(); err != nil {
 			return nil, err
 		}
+		d.Span = p.span(start)
 		return &d, nil
 	}
 }
@@ -1410,6 +1997,7 @@ func (p *parser) parseCharRef() (*CharRef, error) {
 	var ref CharRef
 	var err error
 
+	start := p.pos()
 	if p.Tests("&#x") {
 		ref.Prefix = "&#x"
 		p.StepN(len("&#x"))
@@ -1419,11 +2007,12 @@ func (p *parser) parseCharRef() (*CharRef, error) {
 			return nil, p.error(errors.New("expected number or alphabet character"))
 		}
 
+		from := p.cursor
 		for isNum(r) || isAlpha(r) {
-			ref.Value += string(r)
 			p.Step()
 			r = p.Get()
 		}
+		ref.Value = p.text(from)
 	} else if p.Tests("&#") {
 		ref.Prefix = "&#"
 		p.StepN(len("&#"))
@@ -1433,11 +2022,12 @@ func (p *parser) parseCharRef() (*CharRef, error) {
 			return nil, p.error(errors.New("expected number"))
 		}
 
+		from := p.cursor
 		for isNum(r) {
-			ref.Value += string(r)
 			p.Step()
 			r = p.Get()
 		}
+		ref.Value = p.text(from)
 	} else {
 		return nil, p.error(errors.New("expected '&#x' or '&#'"))
 	}
@@ -1445,6 +2035,10 @@ func (p *parser) parseCharRef() (*CharRef, error) {
 	if err = p.Must(';'); err != nil {
 		return nil, err
 	}
+	ref.Span = p.span(start)
+	if _, err = ref.Rune(); err != nil {
+		return nil, p.fail(newErr(p.parsing, err, start))
+	}
 
 	return &ref, nil
 }
@@ -1478,6 +2072,7 @@ func (p *parser) parseReference() (Ref, error) {
 // EntityRef ::= '&' Name ';'
 func (p *parser) parseEntityRef() (*EntityRef, error) {
 	var err error
+	start := p.pos()
 	if err = p.Must('&'); err != nil {
 		return nil, err
 	}
@@ -1489,12 +2084,14 @@ func (p *parser) parseEntityRef() (*EntityRef, error) {
 	if err = p.Must(';'); err != nil {
 		return nil, err
 	}
+	e.Span = p.span(start)
 	return &e, nil
 }
 
 // PEReference ::= '%' Name ';'
 func (p *parser) parsePERef() (*PERef, error) {
 	var err error
+	start := p.pos()
 	if err = p.Must('%'); err != nil {
 		return nil, err
 	}
@@ -1506,6 +2103,7 @@ func (p *parser) parsePERef() (*PERef, error) {
 	if err = p.Must(';'); err != nil {
 		return nil, err
 	}
+	e.Span = p.span(start)
 	return &e, nil
 }
 
@@ -1516,6 +2114,7 @@ func (p *parser) parseEntity() (*Entity, error) {
 	defer p.setParsing("Entity Declaration")()
 
 	var err error
+	start := p.pos()
 	if err = p.Musts("<!ENTITY"); err != nil {
 		return nil, err
 	}
@@ -1564,6 +2163,7 @@ func (p *parser) parseEntity() (*Entity, error) {
 	if err = p.Must('>'); err != nil {
 		return nil, err
 	}
+	e.Span = p.span(start)
 
 	return &e, nil
 }
@@ -1629,6 +2229,7 @@ func (p *parser) parsePEDef() (EntityValue, *ExternalID, error) {
 // ExternalID ::= 'SYSTEM' S SystemLiteral | 'PUBLIC' S PubidLiteral S SystemLiteral
 func (p *parser) parseExternalID() (*ExternalID, error) {
 	var ext ExternalID
+	start := p.pos()
 	if p.Tests("SYSTEM") {
 		p.StepN(len("SYSTEM"))
 		ext.Type = ExternalTypeSystem
@@ -1660,6 +2261,7 @@ func (p *parser) parseExternalID() (*ExternalID, error) {
 		return nil, err
 	}
 	ext.System = sys
+	ext.Span = p.span(start)
 
 	return &ext, nil
 }
@@ -1681,6 +2283,49 @@ func (p *parser) parseNData() (string, error) {
 
 /// - Encoding Declaration
 
+// TextDecl ::= '<?xml' VersionInfo? EncodingDecl S? '?>'
+func (p *parser) parseTextDecl() (*TextDecl, error) {
+	defer p.setParsing("Text Declaration")()
+
+	start := p.pos()
+	if err := p.Musts("<?xml"); err != nil {
+		return nil, err
+	}
+	var t TextDecl
+	var err error
+	cur := p.cursor
+	p.skipSpace()
+	hasVersion := p.Tests("version")
+	p.cursor = cur
+	if hasVersion {
+		if t.Version, err = p.parseVersion(); err != nil {
+			return nil, err
+		}
+	}
+	if t.Encoding, err = p.parseEncoding(); err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if err = p.Musts("?>"); err != nil {
+		return nil, err
+	}
+	t.Span = p.span(start)
+	return &t, nil
+}
+
+// atXMLDecl reports whether the cursor is at an XML or text declaration
+// rather than at a PI whose target starts with "xml".
+func (p *parser) atXMLDecl() bool {
+	if !p.Tests("<?xml") {
+		return false
+	}
+	cur := p.cursor
+	p.StepN(len("<?xml"))
+	ok := isSpace(p.Get())
+	p.cursor = cur
+	return ok
+}
+
 // EncodingDecl ::= S 'encoding' Eq ('"' EncName  '"' |  "'" EncName "'" )
 func (p *parser) parseEncoding() (string, error) {
 	var err error
@@ -1714,24 +2359,21 @@ func (p *parser) parseEncoding() (string, error) {
 
 // EncName ::= [A-Za-z] ([A-Za-z0-9._] | '-')*
 func (p *parser) parseEncName() (string, error) {
-	var str string
-	r := p.Get()
-	if !isAlpha(r) {
+	start := p.cursor
+	if !isAlpha(p.Get()) {
 		return "", p.error(errors.New("Encoding name contains non alphabet"))
 	}
-	str += string(r)
 	p.Step()
 
 	for {
 		if isAlpha(p.Get()) || isNum(p.Get()) || p.Test('.') || p.Test('_') || p.Test('-') {
-			str += string(p.Get())
 			p.Step()
 		} else {
 			break
 		}
 	}
 
-	return str, nil
+	return p.text(start), nil
 }
 
 /// - Notation Declarations
@@ -1742,6 +2384,7 @@ func (p *parser) parseNotation() (*Notation, error) {
 
 	var n Notation
 	var err error
+	start := p.pos()
 	if err = p.Musts("<!NOTATION"); err != nil {
 		return nil, err
 	}
@@ -1757,6 +2400,7 @@ func (p *parser) parseNotation() (*Notation, error) {
 
 	// ExternalID ::= 'SYSTEM' S SystemLiteral | 'PUBLIC' S PubidLiteral
 	var ext ExternalID
+	extStart := p.pos()
 	if p.Tests("SYSTEM") {
 		p.StepN(len("SYSTEM"))
 		ext.Type = ExternalTypeSystem
@@ -1803,6 +2447,7 @@ func (p *parser) parseNotation() (*Notation, error) {
 		}
 		ext.System = sys
 	}
+	ext.Span = p.span(extStart)
 
 	n.ExtID = ext
 
@@ -1811,6 +2456,7 @@ func (p *parser) parseNotation() (*Notation, error) {
 	if err = p.Must('>'); err != nil {
 		return nil, err
 	}
+	n.Span = p.span(start)
 
 	return &n, nil
 }
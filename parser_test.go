@@ -8,6 +8,51 @@ import (
 
 func newRune(r rune) *rune { return &r }
 
+var spanType = reflect.TypeOf(Span{})
+
+// withoutSpans clears every Span in v, so that parsed trees can be
+// compared with expected ones by their content.
+func withoutSpans(v interface{}) interface{} {
+	clearSpans(reflect.ValueOf(v))
+	return v
+}
+
+func clearSpans(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			clearSpans(v.Elem())
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		e := v.Elem()
+		if e.Kind() == reflect.Ptr || !v.CanSet() {
+			clearSpans(e)
+			return
+		}
+		c := reflect.New(e.Type()).Elem()
+		c.Set(e)
+		clearSpans(c)
+		v.Set(c)
+	case reflect.Struct:
+		if v.Type() == spanType {
+			if v.CanSet() {
+				v.Set(reflect.Zero(spanType))
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			clearSpans(v.Field(i))
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			clearSpans(v.Index(i))
+		}
+	}
+}
+
 func TestParser_Test(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -31,7 +76,7 @@ func TestParser_Test(t *testing.T) {
 			want:   true,
 		},
 		{
-			cursor: 3,
+			cursor: 5,
 			r:      'あ',
 			want:   false,
 		},
@@ -40,8 +85,8 @@ func TestParser_Test(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			p := parser{
 				scanner: &scanner{
-					source: []rune(" aあ"),
-					cursor: tt.cursor,
+					source: []byte(" aあ"),
+					cursor: cursor{index: tt.cursor},
 				},
 			}
 			if got := p.Test(tt.r); got != tt.want {
@@ -84,13 +129,13 @@ func TestParser_Parse(t *testing.T) {
 						&Element{
 							Name: "title",
 							Contents: []interface{}{
-								"Subjects available in Mechanical Engineering.",
+								&CharData{Value: "Subjects available in Mechanical Engineering."},
 							},
 						},
 						&Element{
 							Name: "subjectID",
 							Contents: []interface{}{
-								"2.303",
+								&CharData{Value: "2.303"},
 							},
 						},
 					},
@@ -105,13 +150,53 @@ func TestParser_Parse(t *testing.T) {
 				t.Errorf("Parser.Parse() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.Parse() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
+func TestParser_spans(t *testing.T) {
+	pos := func(offset uint) Pos { return Pos{Line: 1, Col: offset + 1, Offset: offset} }
+	span := func(start, end uint) Span { return Span{Start: pos(start), End: pos(end)} }
+
+	e, err := newParser(`<a x='1'>t&amp;<!--c--></a>`).parseElement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		got  Span
+		want Span
+	}{
+		{name: "Element", got: e.Span, want: span(0, 27)},
+		{name: "STag", got: e.STag, want: span(0, 9)},
+		{name: "ETag", got: e.ETag, want: span(23, 27)},
+		{name: "Attribute", got: e.Attrs[0].Span, want: span(3, 8)},
+		{name: "Attribute name", got: e.Attrs[0].NameSpan, want: span(3, 4)},
+		{name: "Attribute value", got: e.Attrs[0].ValueSpan, want: span(5, 8)},
+		{name: "CharData", got: e.Contents[0].(*CharData).Span, want: span(9, 10)},
+		{name: "EntityRef", got: e.Contents[1].(*EntityRef).Span, want: span(10, 15)},
+		{name: "Comment", got: e.Contents[2].(*Comment).Span, want: span(15, 23)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("Span = %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+
+	empty, err := newParser(`<b/>`).parseElement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.STag != span(0, 4) || empty.ETag != (Span{}) {
+		t.Errorf("empty-element tag STag = %v, ETag = %v", empty.STag, empty.ETag)
+	}
+}
+
 func TestParser_parseProlog(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -159,7 +244,7 @@ func TestParser_parseProlog(t *testing.T) {
 					Version: "1.0",
 				},
 				Misc1: []Misc{
-					Comment("misc1"),
+					&Comment{Value: "misc1"},
 				},
 				DOCType: &DOCType{
 					Name: "document",
@@ -169,7 +254,7 @@ func TestParser_parseProlog(t *testing.T) {
 					},
 				},
 				Misc2: []Misc{
-					Comment("misc2"),
+					&Comment{Value: "misc2"},
 				},
 			},
 		},
@@ -181,7 +266,7 @@ func TestParser_parseProlog(t *testing.T) {
 				t.Errorf("Parser.parseProlog() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseProlog() = %v, want %v", got, tt.want)
 			}
 		})
@@ -244,7 +329,7 @@ func TestParser_parseXmlDecl(t *testing.T) {
 				t.Errorf("Parser.parseXmlDecl() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseXmlDecl() = %v, want %v", got, tt.want)
 			}
 		})
@@ -332,7 +417,7 @@ func TestParser_parseMisc(t *testing.T) {
 		{
 			name:   "parse comment",
 			source: `<!-- comment -->`,
-			want:   Comment(" comment "),
+			want:   &Comment{Value: " comment "},
 		},
 		{
 			name:   "parse PI",
@@ -350,7 +435,7 @@ func TestParser_parseMisc(t *testing.T) {
 				t.Errorf("Parser.parseMisc() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseMisc() = %v, want %v", got, tt.want)
 			}
 		})
@@ -442,7 +527,7 @@ func TestParser_parseEntityValue(t *testing.T) {
 				t.Errorf("Parser.parseEntityValue() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseEntityValue() = %v, want %v", got, tt.want)
 			}
 		})
@@ -485,17 +570,22 @@ func TestParser_parseAttValue(t *testing.T) {
 		},
 		{
 			name:   "CharRef",
-			source: `"&#11;"`,
+			source: `"&#13;"`,
 			want: AttValue{
-				&CharRef{Prefix: "&#", Value: "11"},
+				&CharRef{Prefix: "&#", Value: "13"},
 			},
 		},
+		{
+			name:    "CharRef to illegal character",
+			source:  `"&#11;"`,
+			wantErr: true,
+		},
 		{
 			name:   "multiple values",
-			source: `"bb&#11;&#x20;&a;"`,
+			source: `"bb&#13;&#x20;&a;"`,
 			want: AttValue{
 				"bb",
-				&CharRef{Prefix: "&#", Value: "11"},
+				&CharRef{Prefix: "&#", Value: "13"},
 				&CharRef{Prefix: "&#x", Value: "20"},
 				&EntityRef{Name: "a"},
 			},
@@ -517,7 +607,7 @@ func TestParser_parseAttValue(t *testing.T) {
 				t.Errorf("Parser.parseAttValue() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseAttValue() = %v, want %v", got, tt.want)
 			}
 		})
@@ -610,7 +700,7 @@ func TestParser_parseComment(t *testing.T) {
 	tests := []struct {
 		name    string
 		source  string
-		want    Comment
+		want    *Comment
 		wantErr bool
 	}{
 		{
@@ -630,7 +720,7 @@ func TestParser_parseComment(t *testing.T) {
 		},
 		{
 			source: "<!-- this is comment-->",
-			want:   Comment(" this is comment"),
+			want:   &Comment{Value: " this is comment"},
 		},
 	}
 	for _, tt := range tests {
@@ -640,7 +730,7 @@ func TestParser_parseComment(t *testing.T) {
 				t.Errorf("Parser.parseComment() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if got != tt.want {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseComment() = %v, want %v", got, tt.want)
 			}
 		})
@@ -684,7 +774,7 @@ func TestParser_parsePI(t *testing.T) {
 				t.Errorf("Parser.parsePI() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parsePI() = %v, want %v", got, tt.want)
 			}
 		})
@@ -757,7 +847,7 @@ func TestParser_parseCDSect(t *testing.T) {
 	tests := []struct {
 		name    string
 		source  string
-		want    CData
+		want    *CData
 		wantErr bool
 	}{
 		{
@@ -782,7 +872,7 @@ func TestParser_parseCDSect(t *testing.T) {
 					<!ATTLIST student_name tutor_1 IDREF #IMPLIED>
 					<!ATTLIST student_name tutor_2 IDREF #IMPLIED>
 				]> ]]>`,
-			want: `
+			want: &CData{Value: `
 				any characters (including markup)
 
 				<!DOCTYPE lab_group [
@@ -791,7 +881,7 @@ func TestParser_parseCDSect(t *testing.T) {
 					<!ATTLIST student_name student_no ID #REQUIRED>
 					<!ATTLIST student_name tutor_1 IDREF #IMPLIED>
 					<!ATTLIST student_name tutor_2 IDREF #IMPLIED>
-				]> `,
+				]> `},
 		},
 	}
 	for _, tt := range tests {
@@ -801,7 +891,7 @@ func TestParser_parseCDSect(t *testing.T) {
 				t.Errorf("Parser.parseCDSect() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if got != tt.want {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseCDSect() = %v, want %v", got, tt.want)
 			}
 		})
@@ -849,6 +939,27 @@ func TestParser_parseDoctype(t *testing.T) {
 			] >`,
 			wantErr: true,
 		},
+		{
+			name: "PERefs in order",
+			source: `<!DOCTYPE name [
+				%a;
+				<!ELEMENT name EMPTY>
+				%b;
+			] >`,
+			want: &DOCType{
+				Name: "name",
+				Markups: []Markup{
+					&PERef{Name: "a"},
+					&ElementDecl{Name: "name", ContentSpec: &EMPTY{}},
+					&PERef{Name: "b"},
+				},
+			},
+		},
+		{
+			name:    "conditional section in internal subset",
+			source:  `<!DOCTYPE name [<![INCLUDE[]]>]>`,
+			wantErr: true,
+		},
 		{
 			name:    "not closed ]",
 			source:  `<!DOCTYPE name [`,
@@ -917,7 +1028,7 @@ func TestParser_parseDoctype(t *testing.T) {
 				t.Errorf("Parser.parseDoctype() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseDoctype() = %v, want %v", got, tt.want)
 			}
 		})
@@ -1018,7 +1129,7 @@ func TestParser_parseMarkup(t *testing.T) {
 		{
 			name:   "Comment",
 			source: `<!-- this is comment -->`,
-			want:   Comment(" this is comment "),
+			want:   &Comment{Value: " this is comment "},
 		},
 	}
 	for _, tt := range tests {
@@ -1028,7 +1139,7 @@ func TestParser_parseMarkup(t *testing.T) {
 				t.Errorf("Parser.parseMarkup() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseMarkup() = %v, want %v", got, tt.want)
 			}
 		})
@@ -1157,8 +1268,8 @@ func TestParser_parseElement(t *testing.T) {
 			want: &Element{
 				Name: "name",
 				Contents: []interface{}{
-					Comment("comment"),
-					"aaa",
+					&Comment{Value: "comment"},
+					&CharData{Value: "aaa"},
 				},
 			},
 		},
@@ -1170,7 +1281,7 @@ func TestParser_parseElement(t *testing.T) {
 				t.Errorf("Parser.parseElement() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseElement() = %v, want %v", got, tt.want)
 			}
 		})
@@ -1216,7 +1327,7 @@ func TestParser_parseAttribute(t *testing.T) {
 				t.Errorf("Parser.parseAttribute() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseAttribute() = %v, want %v", got, tt.want)
 			}
 		})
@@ -1310,7 +1421,7 @@ func TestParser_parseContents(t *testing.T) {
 			name:   "element after charData",
 			source: "char<Element/>",
 			want: []interface{}{
-				"char",
+				&CharData{Value: "char"},
 				&Element{
 					Name:       "Element",
 					IsEmptyTag: true,
@@ -1321,7 +1432,7 @@ func TestParser_parseContents(t *testing.T) {
 			name:   "only charData",
 			source: "char",
 			want: []interface{}{
-				"char",
+				&CharData{Value: "char"},
 			},
 		},
 		{
@@ -1332,21 +1443,21 @@ func TestParser_parseContents(t *testing.T) {
 					Name:       "a",
 					IsEmptyTag: true,
 				},
-				"chardata",
+				&CharData{Value: "chardata"},
 				&EntityRef{
 					Name: "entityref",
 				},
-				CData("cdata"),
+				&CData{Value: "cdata"},
 				&PI{
 					Target: "pitarget",
 				},
-				Comment("comment"),
+				&Comment{Value: "comment"},
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := newParser(tt.source).parseContents(); !reflect.DeepEqual(got, tt.want) {
+			if got := newParser(tt.source).parseContents(); !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseContents() = %v, want %v", got, tt.want)
 			}
 		})
@@ -1414,7 +1525,7 @@ func TestParser_parseElementDecl(t *testing.T) {
 				t.Errorf("Parser.parseElement() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseElement() = %v, want %v", got, tt.want)
 			}
 		})
@@ -1469,7 +1580,7 @@ func TestParser_parseContentSpec(t *testing.T) {
 				t.Errorf("Parser.parseContentSpec() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseContentSpec() = %v, want %v", got, tt.want)
 			}
 		})
@@ -1546,7 +1657,7 @@ func TestParser_parseChildren(t *testing.T) {
 				t.Errorf("Parser.parseChildren() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseChildren() = %v, want %v", got, tt.want)
 			}
 		})
@@ -1599,7 +1710,7 @@ func TestParser_parseCP(t *testing.T) {
 				t.Errorf("Parser.parseCP() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseCP() = %v, want %v", got, tt.want)
 			}
 		})
@@ -1634,6 +1745,20 @@ func TestParser_parseChoice(t *testing.T) {
 			source:  `(surname|firstname`,
 			wantErr: true,
 		},
+		{
+			name:   "spaces around separator",
+			source: `( surname | firstname )`,
+			want: &Choice{
+				CPs: []CP{
+					CP{
+						Name: "surname",
+					},
+					CP{
+						Name: "firstname",
+					},
+				},
+			},
+		},
 		{
 			source: `(surname|firstname)`,
 			want: &Choice{
@@ -1655,7 +1780,7 @@ func TestParser_parseChoice(t *testing.T) {
 				t.Errorf("Parser.parseChoice() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseChoice() = %v, want %v", got, tt.want)
 			}
 		})
@@ -1690,6 +1815,20 @@ func TestParser_parseSeq(t *testing.T) {
 			source:  `(surname,firstname*`,
 			wantErr: true,
 		},
+		{
+			name:   "spaces around separator",
+			source: `( surname , firstname )`,
+			want: &Seq{
+				CPs: []CP{
+					CP{
+						Name: "surname",
+					},
+					CP{
+						Name: "firstname",
+					},
+				},
+			},
+		},
 		{
 			source: `(surname,firstname*)`,
 			want: &Seq{
@@ -1712,7 +1851,7 @@ func TestParser_parseSeq(t *testing.T) {
 				t.Errorf("Parser.parseSeq() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseSeq() = %v, want %v", got, tt.want)
 			}
 		})
@@ -1774,7 +1913,7 @@ func TestParser_parseMixed(t *testing.T) {
 				t.Errorf("Parser.parseMixed() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseMixed() = %v, want %v", got, tt.want)
 			}
 		})
@@ -1850,7 +1989,7 @@ func TestParser_parseAttlist(t *testing.T) {
 				t.Errorf("Parser.parseAttlist() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseAttlist() = %v, want %v", got, tt.want)
 			}
 		})
@@ -1912,7 +2051,7 @@ func TestParser_parseAttDef(t *testing.T) {
 				t.Errorf("Parser.parseAttDef() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseAttDef() = %v, want %v", got, tt.want)
 			}
 		})
@@ -1982,7 +2121,7 @@ func TestParser_parseAttType(t *testing.T) {
 				t.Errorf("Parser.parseAttType() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseAttType() = %v, want %v", got, tt.want)
 			}
 		})
@@ -2045,7 +2184,7 @@ func TestParser_parseNotationType(t *testing.T) {
 				t.Errorf("Parser.parseNotationType() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseNotationType() = %v, want %v", got, tt.want)
 			}
 		})
@@ -2098,7 +2237,7 @@ func TestParser_parseEnum(t *testing.T) {
 				t.Errorf("Parser.parseEnum() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseEnum() = %v, want %v", got, tt.want)
 			}
 		})
@@ -2145,7 +2284,7 @@ func TestParser_parseDefaultDecl(t *testing.T) {
 			name:   "no #FIXED",
 			source: `"aa"`,
 			want: &DefaultDecl{
-				Type:     DefaultDeclTypeFixed,
+				Type:     DefaultDeclTypeValue,
 				AttValue: []interface{}{"aa"},
 			},
 		},
@@ -2157,7 +2296,7 @@ func TestParser_parseDefaultDecl(t *testing.T) {
 				t.Errorf("Parser.parseDefaultDecl() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseDefaultDecl() = %v, want %v", got, tt.want)
 			}
 		})
@@ -2191,6 +2330,16 @@ func TestParser_parseCharRef(t *testing.T) {
 			source:  `&#xa`,
 			wantErr: true,
 		},
+		{
+			name:    "illegal character",
+			source:  `&#0;`,
+			wantErr: true,
+		},
+		{
+			name:    "not a hexadecimal number",
+			source:  `&#xag;`,
+			wantErr: true,
+		},
 		{
 			source: `&#xcc;`,
 			want: &CharRef{
@@ -2206,7 +2355,7 @@ func TestParser_parseCharRef(t *testing.T) {
 				t.Errorf("Parser.parseCharRef() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseCharRef() = %v, want %v", got, tt.want)
 			}
 		})
@@ -2249,13 +2398,79 @@ func TestParser_parseEntityReference(t *testing.T) {
 				t.Errorf("Parser.parseEntityReference() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseEntityReference() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
+func TestParser_parseCondSect(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		want    *CondSect
+		wantErr bool
+	}{
+		{
+			name:   "include",
+			source: `<![ INCLUDE [ <!ELEMENT a EMPTY> <![IGNORE[ x ]]> ]]>`,
+			want: &CondSect{
+				Keyword: "INCLUDE",
+				Markups: []Markup{
+					&ElementDecl{Name: "a", ContentSpec: &EMPTY{}},
+					&CondSect{Keyword: "IGNORE", Ignored: " x "},
+				},
+			},
+		},
+		{
+			name:   "nested ignore",
+			source: `<![IGNORE[ <!ELEMENT a EMPTY> <![INCLUDE[ <!-- ]]> ]]>`,
+			want: &CondSect{
+				Keyword: "IGNORE",
+				Ignored: " <!ELEMENT a EMPTY> <![INCLUDE[ <!-- ]]> ",
+			},
+		},
+		{
+			name:   "keyword not expanded",
+			source: `<![%draft;[<!ELEMENT a EMPTY>]]>`,
+			want: &CondSect{
+				KeywordRef: &PERef{Name: "draft"},
+				Ignored:    "<!ELEMENT a EMPTY>",
+			},
+		},
+		{
+			name:    "unknown keyword",
+			source:  `<![EXCLUDE[]]>`,
+			wantErr: true,
+		},
+		{
+			name:    "not closed include",
+			source:  `<![INCLUDE[<!ELEMENT a EMPTY>`,
+			wantErr: true,
+		},
+		{
+			name:    "not closed ignore",
+			source:  `<![IGNORE[<![IGNORE[]]>`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newParser(tt.source)
+			p.external = true
+			got, err := p.parseCondSect(nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parser.parseCondSect() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
+				t.Errorf("Parser.parseCondSect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestParser_parsePERef(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -2292,7 +2507,7 @@ func TestParser_parsePERef(t *testing.T) {
 				t.Errorf("Parser.parsePERef() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parsePERef() = %v, want %v", got, tt.want)
 			}
 		})
@@ -2367,7 +2582,7 @@ func TestParser_parseEntity(t *testing.T) {
 				t.Errorf("Parser.parseEntity() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseEntity() = %v, want %v", got, tt.want)
 			}
 		})
@@ -2433,10 +2648,10 @@ func TestParser_parseEntityDef(t *testing.T) {
 				t.Errorf("Parser.parseEntityDef() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseEntityDef() got = %v, want %v", got, tt.want)
 			}
-			if !reflect.DeepEqual(got1, tt.want1) {
+			if !reflect.DeepEqual(withoutSpans(got1), tt.want1) {
 				t.Errorf("Parser.parseEntityDef() got1 = %v, want %v", got1, tt.want1)
 			}
 			if got2 != tt.want2 {
@@ -2495,10 +2710,10 @@ func TestParser_parsePEDef(t *testing.T) {
 				t.Errorf("Parser.parsePEDef() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parsePEDef() got = %v, want %v", got, tt.want)
 			}
-			if !reflect.DeepEqual(got1, tt.want1) {
+			if !reflect.DeepEqual(withoutSpans(got1), tt.want1) {
 				t.Errorf("Parser.parsePEDef() got1 = %v, want %v", got1, tt.want1)
 			}
 		})
@@ -2562,7 +2777,7 @@ func TestParser_parseExternalID(t *testing.T) {
 				t.Errorf("Parser.parseExternalID() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseExternalID() = %v, want %v", got, tt.want)
 			}
 		})
@@ -2802,7 +3017,7 @@ func TestParser_parseNotation(t *testing.T) {
 				t.Errorf("Parser.parseNotation() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
 				t.Errorf("Parser.parseNotation() = %v, want %v", got, tt.want)
 			}
 		})
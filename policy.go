@@ -0,0 +1,118 @@
+package xml
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// EntityPolicy decides which external entities may be opened. name is the
+// name of the entity, with a "%" prefix for a parameter entity, or "[dtd]"
+// for the external DTD subset, and uri is its system identifier resolved
+// against the base URI.
+type EntityPolicy interface {
+	AllowEntity(name, publicID, systemID, uri string) bool
+}
+
+// DenyAll refuses every external entity. It is the policy of a parse that
+// does not set another with ExternalPolicy.
+type DenyAll struct{}
+
+func (DenyAll) AllowEntity(name, publicID, systemID, uri string) bool {
+	return false
+}
+
+// AllowDirs allows the local files in the listed directories and their
+// subdirectories. Symbolic links are followed before the file is checked,
+// so a link to a file outside the directories is refused, as is a file
+// that does not exist.
+type AllowDirs []string
+
+func (dirs AllowDirs) AllowEntity(name, publicID, systemID, uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "" && u.Scheme != "file" {
+		return false
+	}
+	file, err := realPath(filepath.FromSlash(u.Path))
+	if err != nil {
+		return false
+	}
+	for _, dir := range dirs {
+		dir, err := realPath(dir)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// realPath returns the absolute path of the file at path with the symbolic
+// links in it resolved.
+func realPath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(path)
+}
+
+// AllowSchemes allows the entities whose URI has one of the listed
+// schemes, e.g. "https". A URI without a scheme has the scheme "file".
+type AllowSchemes []string
+
+func (schemes AllowSchemes) AllowEntity(name, publicID, systemID, uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	scheme := u.Scheme
+	if len(scheme) == 0 {
+		scheme = "file"
+	}
+	for _, s := range schemes {
+		if strings.EqualFold(s, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyFunc allows the entities for which it returns true.
+type PolicyFunc func(name, publicID, systemID, uri string) bool
+
+func (f PolicyFunc) AllowEntity(name, publicID, systemID, uri string) bool {
+	return f(name, publicID, systemID, uri)
+}
+
+// ExternalEntityError reports an external entity that the EntityPolicy
+// did not allow to be opened.
+type ExternalEntityError struct {
+	// name of the entity as given to EntityPolicy
+	Entity   string
+	SystemID string
+}
+
+func (e *ExternalEntityError) Error() string {
+	return fmt.Sprintf("external entity %q with system identifier %q is not allowed", e.Entity, e.SystemID)
+}
+
+// allowEntity checks the entity name identified by ext, declared in the
+// resource at base, against the EntityPolicy.
+func (p *parser) allowEntity(name string, ext *ExternalID, base string) error {
+	policy := p.policy
+	if policy == nil {
+		policy = DenyAll{}
+	}
+	if !policy.AllowEntity(name, ext.Pubid, ext.System, resolveURI(base, ext.System)) {
+		return &ExternalEntityError{
+			Entity:   name,
+			SystemID: ext.System,
+		}
+	}
+	return nil
+}
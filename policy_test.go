@@ -0,0 +1,120 @@
+package xml
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse_ExternalPolicy(t *testing.T) {
+	files := MapResolver{
+		"doc.dtd":     `<!ELEMENT a ANY>`,
+		"text.ent":    `text`,
+		"secret.ent":  `secret`,
+		"http://x/sd": `<!ELEMENT a ANY>`,
+	}
+	tests := []struct {
+		name    string
+		source  string
+		opts    []ParseOption
+		wantErr *ExternalEntityError
+	}{
+		{
+			name:    "deny by default",
+			source:  `<!DOCTYPE a SYSTEM "doc.dtd"><a/>`,
+			wantErr: &ExternalEntityError{Entity: "[dtd]", SystemID: "doc.dtd"},
+		},
+		{
+			name:    "DenyAll",
+			source:  `<!DOCTYPE a [<!ENTITY t SYSTEM "text.ent">]><a>&t;</a>`,
+			opts:    []ParseOption{ExternalPolicy(DenyAll{}), ExpandEntities()},
+			wantErr: &ExternalEntityError{Entity: "t", SystemID: "text.ent"},
+		},
+		{
+			name:   "AllowSchemes",
+			source: `<!DOCTYPE a SYSTEM "http://x/sd"><a/>`,
+			opts:   []ParseOption{ExternalPolicy(AllowSchemes{"HTTP"})},
+		},
+		{
+			name:    "scheme not allowed",
+			source:  `<!DOCTYPE a SYSTEM "http://x/sd"><a/>`,
+			opts:    []ParseOption{ExternalPolicy(AllowSchemes{"file", "https"})},
+			wantErr: &ExternalEntityError{Entity: "[dtd]", SystemID: "http://x/sd"},
+		},
+		{
+			name:   "PolicyFunc",
+			source: `<!DOCTYPE a SYSTEM "doc.dtd" [<!ENTITY t SYSTEM "text.ent">]><a>&t;</a>`,
+			opts: []ParseOption{ExternalPolicy(PolicyFunc(func(name, publicID, systemID, uri string) bool {
+				return uri != "secret.ent"
+			})), ExpandEntities()},
+		},
+		{
+			name:   "PolicyFunc refusing",
+			source: `<!DOCTYPE a [<!ENTITY % s SYSTEM "secret.ent">%s;]><a/>`,
+			opts: []ParseOption{ExternalPolicy(PolicyFunc(func(name, publicID, systemID, uri string) bool {
+				return uri != "secret.ent"
+			})), ExpandParameterEntities()},
+			wantErr: &ExternalEntityError{Entity: "%s", SystemID: "secret.ent"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.source, append(tt.opts, Resolver(files))...)
+			var got *ExternalEntityError
+			if !errors.As(err, &got) && err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if tt.wantErr == nil && got != nil || tt.wantErr != nil && (got == nil || *got != *tt.wantErr) {
+				t.Errorf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAllowDirs(t *testing.T) {
+	dir := filepath.ToSlash(t.TempDir())
+	for _, file := range []string{"dtd/doc.dtd", "dtd/sub/doc.dtd", "dtdx/doc.dtd", "secret"} {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"dtd/escape.dtd": "../secret",
+		"dtd/inner.dtd":  "sub/doc.dtd",
+		"alias":          "dtd",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Skipf("symbolic links are not supported: %v", err)
+		}
+	}
+	allow := AllowDirs{dir + "/dtd"}
+	tests := []struct {
+		uri  string
+		want bool
+	}{
+		{uri: dir + "/dtd/doc.dtd", want: true},
+		{uri: dir + "/dtd/sub/doc.dtd", want: true},
+		{uri: "file://" + dir + "/dtd/doc.dtd", want: true},
+		{uri: dir + "/dtd/inner.dtd", want: true},
+		{uri: dir + "/alias/doc.dtd", want: true},
+		{uri: dir + "/dtd/escape.dtd", want: false},
+		{uri: dir + "/dtd/missing.dtd", want: false},
+		{uri: dir + "/dtd/../secret", want: false},
+		{uri: dir + "/dtdx/doc.dtd", want: false},
+		{uri: "/etc/passwd", want: false},
+		{uri: "http://example.com" + dir + "/dtd/doc.dtd", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			if got := allow.AllowEntity("e", "", tt.uri, tt.uri); got != tt.want {
+				t.Errorf("AllowEntity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,4 +3,13 @@ package xml
 type Pos struct {
 	Line uint
 	Col  uint
+	// byte offset in the input, counting a UTF-8 byte order mark; for input
+	// in another encoding, byte offset in the input transcoded to UTF-8
+	Offset uint
+}
+
+// Span is the range of source text from Start up to, but not including, End.
+type Span struct {
+	Start Pos
+	End   Pos
 }
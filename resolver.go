@@ -0,0 +1,132 @@
+package xml
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// EntityResolver opens the external entities a document refers to:
+// the external DTD subset and external parsed entities. baseURI is the
+// URI of the resource the entity is declared in, against which a relative
+// systemID is resolved.
+type EntityResolver interface {
+	ResolveEntity(publicID, systemID, baseURI string) (io.Reader, error)
+}
+
+// FileResolver opens external entities from the local file system.
+// System identifiers with a scheme other than file are rejected.
+type FileResolver struct{}
+
+func (FileResolver) ResolveEntity(publicID, systemID, baseURI string) (io.Reader, error) {
+	u, err := url.Parse(resolveURI(baseURI, systemID))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "" && u.Scheme != "file" {
+		return nil, fmt.Errorf("%q is not a local file", systemID)
+	}
+	return os.Open(filepath.FromSlash(u.Path))
+}
+
+// MapResolver serves external entities from memory, keyed by their system
+// identifier resolved against the base URI.
+type MapResolver map[string]string
+
+func (m MapResolver) ResolveEntity(publicID, systemID, baseURI string) (io.Reader, error) {
+	uri := resolveURI(baseURI, systemID)
+	text, ok := m[uri]
+	if !ok {
+		return nil, fmt.Errorf("no entity at %q", uri)
+	}
+	return strings.NewReader(text), nil
+}
+
+// resolveURI resolves ref against base. A base without a scheme is taken
+// as a file path.
+func resolveURI(base, ref string) string {
+	if len(base) == 0 {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil || r.IsAbs() || path.IsAbs(r.Path) {
+		return ref
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	if !b.IsAbs() {
+		return path.Join(path.Dir(base), ref)
+	}
+	return b.ResolveReference(r).String()
+}
+
+// open reads the external entity name identified by ext, declared in the
+// resource at base, if the EntityPolicy allows it and it fits in the
+// MaxSize of the ExpansionLimits. It returns the text of the entity without
+// its text declaration and the URI it was read from.
+func (p *parser) open(name string, ext *ExternalID, base string) (string, string, error) {
+	if err := p.allowEntity(name, ext, base); err != nil {
+		return "", "", err
+	}
+	r, err := p.resolver.ResolveEntity(ext.Pubid, ext.System, base)
+	if err != nil {
+		return "", "", err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	r, _, err = p.detectEncoding(r)
+	if err != nil {
+		return "", "", err
+	}
+	// read no more than the rest of the replacement text ExpansionLimits allow
+	max := int64(-1)
+	if l := p.expansionLimits.MaxSize; l > 0 && p.expansion != nil {
+		max = l - p.expansion.size
+		r = io.LimitReader(r, max+1)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", "", err
+	}
+	if max >= 0 && int64(len(b)) > max {
+		return "", "", fmt.Errorf("%w: replacement text longer than %d bytes", ErrExpansionLimit, p.expansionLimits.MaxSize)
+	}
+
+	s := newParser(string(b))
+	if s.atXMLDecl() {
+		if _, err := s.parseTextDecl(); err != nil {
+			return "", "", err
+		}
+	}
+	return string(s.source[s.cursor.index:]), resolveURI(base, ext.System), nil
+}
+
+// loadExtSubset reads the declarations of the external subset identified
+// by ext, which follows the internal subset intSubset.
+func (p *parser) loadExtSubset(ext *ExternalID, intSubset []Markup) ([]Markup, error) {
+	text, uri, err := p.open("[dtd]", ext, p.baseURI)
+	if err != nil {
+		return nil, newErr(p.parsing, fmt.Errorf("external subset %q: %w", ext.System, err), ext.Start)
+	}
+	sub := *p
+	sub.scanner = &scanner{
+		source: []byte(text),
+	}
+	sub.baseURI = uri
+	sub.external = true
+	sub.expandPEs = true
+	n := len(intSubset)
+	markups, err := sub.parseDecls(intSubset[:n:n])
+	if err != nil {
+		return nil, newErr(p.parsing, fmt.Errorf("in external subset %q: %w", ext.System, err), ext.Start)
+	}
+	p.unreadPERef = sub.unreadPERef
+	return markups[n:], nil
+}
@@ -0,0 +1,184 @@
+package xml
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParse_LoadExternal(t *testing.T) {
+	files := MapResolver{
+		"doc.dtd": `<?xml version="1.0" encoding="UTF-8"?>
+<!ENTITY % content "(b | c)*">
+<!ELEMENT a %content;>
+<!ENTITY % decls SYSTEM "dtd/decls.ent">
+%decls;
+<!ENTITY e "internal wins">`,
+		"dtd/decls.ent": `<?xml encoding="UTF-8"?><!ENTITY ext SYSTEM "text.ent">`,
+		"dtd/text.ent":  `<?xml encoding="UTF-8"?>text <b/>`,
+		"pe.ent":        `<!ELEMENT b EMPTY>`,
+	}
+	allow := ExternalPolicy(AllowSchemes{"file"})
+	tests := []struct {
+		name      string
+		source    string
+		opts      []ParseOption
+		extSubset []Markup
+		markups   []Markup
+		contents  []interface{}
+		wantErr   bool
+	}{
+		{
+			name:   "external subset",
+			source: `<!DOCTYPE a SYSTEM "doc.dtd" [<!ENTITY e "x">]><a>&e;&ext;</a>`,
+			opts:   []ParseOption{Resolver(files), allow, ExpandEntities()},
+			markups: []Markup{
+				&Entity{Name: "e", Value: EntityValue{"x"}},
+			},
+			extSubset: []Markup{
+				&Entity{Name: "content", Type: EntityTypePE, Value: EntityValue{"(b | c)*"}},
+				&ElementDecl{Name: "a", ContentSpec: &Children{ChoiceSeq: &Choice{CPs: []CP{{Name: "b"}, {Name: "c"}}}, Suffix: newRune('*')}, PERefs: []*PERef{{Name: "content"}}},
+				&Entity{Name: "decls", Type: EntityTypePE, ExtID: &ExternalID{Type: ExternalTypeSystem, System: "dtd/decls.ent"}},
+				&Entity{Name: "ext", ExtID: &ExternalID{Type: ExternalTypeSystem, System: "text.ent"}, PERefs: []*PERef{{Name: "decls"}}},
+				&Entity{Name: "e", Value: EntityValue{"internal wins"}},
+			},
+			contents: []interface{}{
+				&CharData{Value: "xtext "},
+				&Element{Name: "b", IsEmptyTag: true},
+			},
+		},
+		{
+			name:   "external parameter entity in internal subset",
+			source: `<!DOCTYPE a [<!ENTITY % pe SYSTEM "pe.ent"> %pe;]><a/>`,
+			opts:   []ParseOption{Resolver(files), allow, ExpandParameterEntities()},
+			markups: []Markup{
+				&Entity{Name: "pe", Type: EntityTypePE, ExtID: &ExternalID{Type: ExternalTypeSystem, System: "pe.ent"}},
+				&ElementDecl{Name: "b", ContentSpec: &EMPTY{}, PERefs: []*PERef{{Name: "pe"}}},
+			},
+		},
+		{
+			name:   "base URI",
+			source: `<!DOCTYPE a [<!ENTITY t SYSTEM "text.ent">]><a>&t;</a>`,
+			opts:   []ParseOption{Resolver(files), allow, BaseURI("dtd/doc.xml"), ExpandEntities()},
+			markups: []Markup{
+				&Entity{Name: "t", ExtID: &ExternalID{Type: ExternalTypeSystem, System: "text.ent"}},
+			},
+			contents: []interface{}{
+				&CharData{Value: "text "},
+				&Element{Name: "b", IsEmptyTag: true},
+			},
+		},
+		{
+			name:   "not loaded without option",
+			source: `<!DOCTYPE a SYSTEM "missing.dtd"><a/>`,
+		},
+		{
+			name:    "missing external subset",
+			source:  `<!DOCTYPE a SYSTEM "missing.dtd"><a/>`,
+			opts:    []ParseOption{Resolver(files), allow},
+			wantErr: true,
+		},
+		{
+			name:    "undeclared parameter entity in declaration",
+			source:  `<!DOCTYPE a SYSTEM "bad.dtd"><a/>`,
+			opts:    []ParseOption{Resolver(MapResolver{"bad.dtd": `<!ELEMENT a %undeclared;>`}), allow},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := Parse(tt.source, tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			d := x.Prolog.DOCType
+			if got := withoutSpans(d.Markups); !reflect.DeepEqual(got, tt.markups) {
+				t.Errorf("Markups = %v, want %v", got, tt.markups)
+			}
+			if got := withoutSpans(d.ExtSubset); !reflect.DeepEqual(got, tt.extSubset) {
+				t.Errorf("ExtSubset = %v, want %v", got, tt.extSubset)
+			}
+			if got := withoutSpans(x.Element.Contents); !reflect.DeepEqual(got, tt.contents) {
+				t.Errorf("Contents = %v, want %v", got, tt.contents)
+			}
+		})
+	}
+}
+
+// endlessResolver opens every entity as endless text.
+type endlessResolver struct{}
+
+func (endlessResolver) ResolveEntity(publicID, systemID, baseURI string) (io.Reader, error) {
+	return endlessReader{}, nil
+}
+
+type endlessReader struct{}
+
+func (endlessReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 'x'
+	}
+	return len(b), nil
+}
+
+func TestParse_externalExpansionLimits(t *testing.T) {
+	const source = `<!DOCTYPE a [<!ENTITY e SYSTEM "e.txt">]><a>&e;</a>`
+	_, err := Parse(source, Resolver(endlessResolver{}), ExternalPolicy(AllowSchemes{"file"}), ExpandEntities(),
+		LimitExpansion(ExpansionLimits{MaxSize: 1 << 20}))
+	if !errors.Is(err, ErrExpansionLimit) {
+		t.Errorf("Parse() error = %v, want %v", err, ErrExpansionLimit)
+	}
+}
+
+func TestFileResolver(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "doc.dtd"), []byte(`<!ELEMENT a EMPTY>`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	x, err := Parse(`<!DOCTYPE a SYSTEM "doc.dtd"><a/>`, LoadExternal(), ExternalPolicy(AllowDirs{dir}), BaseURI(filepath.ToSlash(dir)+"/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Markup{&ElementDecl{Name: "a", ContentSpec: &EMPTY{}}}
+	if got := withoutSpans(x.Prolog.DOCType.ExtSubset); !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtSubset = %v, want %v", got, want)
+	}
+
+	_, err = FileResolver{}.ResolveEntity("", "http://example.com/doc.dtd", "")
+	if err == nil {
+		t.Error("FileResolver opened a remote entity")
+	}
+	_, err = FileResolver{}.ResolveEntity("", "missing.dtd", filepath.ToSlash(dir)+"/")
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("FileResolver error = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func Test_resolveURI(t *testing.T) {
+	tests := []struct {
+		base string
+		ref  string
+		want string
+	}{
+		{base: "", ref: "a.dtd", want: "a.dtd"},
+		{base: "doc.xml", ref: "a.dtd", want: "a.dtd"},
+		{base: "dir/doc.xml", ref: "../a.dtd", want: "a.dtd"},
+		{base: "/dir/sub/", ref: "a.dtd", want: "/dir/sub/a.dtd"},
+		{base: "dir/doc.xml", ref: "/a.dtd", want: "/a.dtd"},
+		{base: "http://example.com/x/doc.xml", ref: "a.dtd", want: "http://example.com/x/a.dtd"},
+		{base: "dir/doc.xml", ref: "file:///a.dtd", want: "file:///a.dtd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.base+" "+tt.ref, func(t *testing.T) {
+			if got := resolveURI(tt.base, tt.ref); got != tt.want {
+				t.Errorf("resolveURI() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -53,3 +53,13 @@ func isPubidChar(r rune) bool {
 func isNameChar(r rune) bool {
 	return isLetter(r) || isDigit(r) || isCombining(r) || isExtender(r) || r == '.' || r == '-' || r == '_' || r == ':'
 }
+
+// Name ::= (Letter | '_' | ':') (NameChar)*
+func isName(s string) bool {
+	for i, r := range s {
+		if i == 0 && !isLetter(r) && r != '_' && r != ':' || !isNameChar(r) {
+			return false
+		}
+	}
+	return len(s) > 0
+}
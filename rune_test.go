@@ -91,3 +91,25 @@ func Test_isLetter(t *testing.T) {
 		})
 	}
 }
+
+func Test_isName(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{s: "a1", want: true},
+		{s: "_a.b-c:d", want: true},
+		{s: "名前", want: true},
+		{s: "1a", want: false},
+		{s: "-a", want: false},
+		{s: "a b", want: false},
+		{s: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			if got := isName(tt.s); got != tt.want {
+				t.Errorf("isName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
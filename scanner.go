@@ -1,49 +1,136 @@
 package xml
 
+import (
+	"io"
+	"unicode/utf8"
+)
+
+// number of bytes requested from reader at a time
+const readSize = 32 << 10
+
 type scanner struct {
-	source []rune
-	cursor uint
+	// source is the UTF-8 input read so far, from offset base on.
+	source []byte
+	// number of bytes of input discarded before source
+	base   uint
+	cursor cursor
+
+	// reader supplies bytes on demand; source grows as the parser looks ahead.
+	reader io.Reader
+	// err holds the first read error other than io.EOF.
+	err error
 }
 
-func (s *scanner) pos() Pos {
-	c := int(s.cursor)
-	if len(s.source) < c {
-		c = len(s.source)
-	}
-
-	sub := s.source[0:c]
-	p := Pos{
-		Line: 1,
-		Col:  1,
-	}
-	for _, v := range sub {
-		if v == '\n' {
-			p.Line++
-			p.Col = 1
-		} else {
-			p.Col++
+// cursor is a byte index into source that keeps track of its own position,
+// so that saving and restoring it also restores the position.
+type cursor struct {
+	index uint
+	// zero-based line and column in runes
+	line uint
+	col  uint
+}
+
+// fill reads from reader until the input read reaches offset n or input ends.
+func (s *scanner) fill(n int) bool {
+	for s.size() < n {
+		if s.reader == nil {
+			return false
+		}
+		l := len(s.source)
+		if cap(s.source)-l < readSize {
+			s.source = append(s.source, make([]byte, readSize)...)[:l]
+		}
+		m, err := s.reader.Read(s.source[l : l+readSize])
+		s.source = s.source[:l+m]
+		if err != nil {
+			if err != io.EOF {
+				s.err = err
+			}
+			s.reader = nil
 		}
 	}
-	return p
+	return true
+}
+
+// size returns the number of bytes of input read so far.
+func (s *scanner) size() int {
+	return int(s.base) + len(s.source)
+}
+
+// discard drops the source before the cursor once it has grown to readSize,
+// so that reading a large document takes bounded memory. Source is only
+// moved when at least as much is dropped, which keeps discarding linear in
+// the input. Cursors before the current one must not be restored afterwards.
+func (s *scanner) discard() {
+	n := s.cursor.index - s.base
+	if n < readSize || int(n) < len(s.source)-int(n) {
+		return
+	}
+	s.source = s.source[:copy(s.source, s.source[n:])]
+	s.base = s.cursor.index
+}
+
+// bytes returns the source from offset from up to offset to.
+func (s *scanner) bytes(from, to uint) []byte {
+	return s.source[from-s.base : to-s.base]
+}
+
+func (c cursor) pos() Pos {
+	return Pos{
+		Line:   c.line + 1,
+		Col:    c.col + 1,
+		Offset: c.index,
+	}
+}
+
+func (s *scanner) pos() Pos {
+	return s.cursor.pos()
+}
+
+// text returns the source from start up to the cursor.
+func (s *scanner) text(start cursor) string {
+	return string(s.bytes(start.index, s.cursor.index))
+}
+
+// peek decodes the rune at the cursor, returning its size in bytes,
+// or 0 at the end of input.
+func (s *scanner) peek() (rune, int) {
+	i := int(s.cursor.index - s.base)
+	if i < len(s.source) && s.source[i] < utf8.RuneSelf {
+		return rune(s.source[i]), 1
+	}
+	if !s.fill(int(s.cursor.index)+utf8.UTFMax) && i >= len(s.source) {
+		return 0, 0
+	}
+	return utf8.DecodeRune(s.source[i:])
 }
 
 func (s *scanner) isEnd() bool {
-	return len(s.source) <= int(s.cursor)
+	return !s.fill(int(s.cursor.index) + 1)
 }
 
 func (s *scanner) Get() rune {
-	if s.isEnd() {
-		return 0
-	}
-	return rune(s.source[s.cursor])
+	r, _ := s.peek()
+	return r
 }
 
+// Step moves the cursor to the next rune. It does nothing at the end of input.
 func (s *scanner) Step() {
-	s.cursor++
+	r, n := s.peek()
+	if n == 0 {
+		return
+	}
+	s.cursor.index += uint(n)
+	if r == '\n' {
+		s.cursor.line++
+		s.cursor.col = 0
+	} else {
+		s.cursor.col++
+	}
 }
 
 func (s *scanner) StepN(n int) {
-	i := int(s.cursor)
-	i += n
-	s.cursor = uint(i)
+	for i := 0; i < n; i++ {
+		s.Step()
+	}
 }
@@ -1,7 +1,10 @@
 package xml
 
 import (
+	"errors"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -43,8 +46,8 @@ func TestScanner_Get(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := &scanner{
-				source: []rune(tt.fields.source),
-				cursor: tt.fields.cursor,
+				source: []byte(tt.fields.source),
+				cursor: cursor{index: tt.fields.cursor},
 			}
 			if got := s.Get(); got != tt.want {
 				t.Errorf("Scanner.Get() = %v, want %v", got, tt.want)
@@ -55,7 +58,7 @@ func TestScanner_Get(t *testing.T) {
 
 func Test_scanner_Pos(t *testing.T) {
 	type fields struct {
-		source []rune
+		source []byte
 		cursor uint
 	}
 	tests := []struct {
@@ -65,47 +68,63 @@ func Test_scanner_Pos(t *testing.T) {
 	}{
 		{
 			fields: fields{
-				source: []rune(`abc
+				source: []byte(`abc
 def
 ghijk
 l`), // a b c \n d e f \n g h i j k \n l
 				cursor: 10, // i
 			},
 			want: Pos{
-				Line: 3,
-				Col:  3,
+				Line:   3,
+				Col:    3,
+				Offset: 10,
 			},
 		},
 		{
 			fields: fields{
-				source: []rune(`abc`),
+				source: []byte(`abc`),
 				cursor: 2,
 			},
 			want: Pos{
-				Line: 1,
-				Col:  3,
+				Line:   1,
+				Col:    3,
+				Offset: 2,
+			},
+		},
+		{
+			name: "multibyte",
+			fields: fields{
+				source: []byte(`aあb`),
+				cursor: 2,
+			},
+			want: Pos{
+				Line:   1,
+				Col:    3,
+				Offset: 4,
 			},
 		},
 		{
 			name: "EOF",
 			fields: fields{
-				source: []rune(`abc`),
+				source: []byte(`abc`),
 				cursor: 3,
 			},
 			want: Pos{
-				Line: 1,
-				Col:  4,
+				Line:   1,
+				Col:    4,
+				Offset: 3,
 			},
 		},
 		{
 			name: "out of bounds",
 			fields: fields{
-				source: []rune(`abc`),
+				source: []byte(`abc`),
 				cursor: 4,
 			},
 			want: Pos{
-				Line: 1,
-				Col:  4,
+				Line:   1,
+				Col:    4,
+				Offset: 3,
 			},
 		},
 	}
@@ -113,11 +132,106 @@ l`), // a b c \n d e f \n g h i j k \n l
 		t.Run(tt.name, func(t *testing.T) {
 			s := &scanner{
 				source: tt.fields.source,
-				cursor: tt.fields.cursor,
 			}
+			s.StepN(int(tt.fields.cursor))
 			if got := s.pos(); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("scanner.Position() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestScanner_restoreCursor(t *testing.T) {
+	s := &scanner{
+		reader: strings.NewReader("ab\ncd"),
+	}
+	s.StepN(2)
+	cur := s.cursor
+	want := s.pos()
+	s.StepN(3)
+	if got := s.pos(); got != (Pos{Line: 2, Col: 3, Offset: 5}) {
+		t.Errorf("scanner.pos() = %v after stepping over a line break", got)
+	}
+	s.cursor = cur
+	if got := s.pos(); got != want {
+		t.Errorf("scanner.pos() = %v after restoring cursor, want %v", got, want)
+	}
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func TestScanner_fill(t *testing.T) {
+	tests := []struct {
+		name    string
+		reader  io.Reader
+		n       int
+		want    bool
+		source  string
+		wantErr bool
+	}{
+		{
+			name:   "read ahead",
+			reader: strings.NewReader("abc"),
+			n:      2,
+			want:   true,
+			source: "abc",
+		},
+		{
+			name:   "EOF",
+			reader: strings.NewReader("abc"),
+			n:      4,
+			want:   false,
+			source: "abc",
+		},
+		{
+			name:    "read error",
+			reader:  errReader{errors.New("broken")},
+			n:       1,
+			want:    false,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &scanner{
+				reader: tt.reader,
+			}
+			if got := s.fill(tt.n); got != tt.want {
+				t.Errorf("scanner.fill() = %v, want %v", got, tt.want)
+			}
+			if string(s.source) != tt.source {
+				t.Errorf("scanner.source = %q, want %q", string(s.source), tt.source)
+			}
+			if (s.err != nil) != tt.wantErr {
+				t.Errorf("scanner.err = %v, wantErr %v", s.err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScanner_discard(t *testing.T) {
+	src := strings.Repeat("a\n", readSize) + "bc"
+	s := newScanner(strings.NewReader(src))
+	s.StepN(2 * readSize)
+	start := s.cursor
+	s.discard()
+	if s.base != uint(2*readSize) {
+		t.Errorf("base = %d, want %d", s.base, 2*readSize)
+	}
+	s.StepN(2)
+	if got := s.text(start); got != "bc" {
+		t.Errorf("text() = %q, want %q", got, "bc")
+	}
+	if got, want := s.pos(), (Pos{Line: readSize + 1, Col: 3, Offset: 2*readSize + 2}); got != want {
+		t.Errorf("pos() = %v, want %v", got, want)
+	}
+	if !s.isEnd() {
+		t.Error("isEnd() = false")
+	}
+}
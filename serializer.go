@@ -0,0 +1,184 @@
+package xml
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Serialize writes a as XML text. Source text recorded by the Lossless
+// option is written as it was read, so that an unmodified tree reproduces
+// its UTF-8 input byte for byte. Nodes created or edited without it get
+// single spaces and double quotes. '&', '<' and the '>' of "]]>" in
+// character data and attribute values are escaped, so that text expanded
+// from references is written back as well-formed XML.
+//
+// A DOCType is written from its Raw source text when it is set;
+// clear Raw after editing the declaration.
+func Serialize(w io.Writer, a AST) error {
+	s := &serializer{
+		w: bufio.NewWriter(w),
+	}
+	s.node(a)
+	if s.err != nil {
+		return s.err
+	}
+	return s.w.Flush()
+}
+
+type serializer struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (s *serializer) print(strs ...string) {
+	for _, str := range strs {
+		if s.err != nil {
+			return
+		}
+		_, s.err = s.w.WriteString(str)
+	}
+}
+
+func (s *serializer) node(a interface{}) {
+	switch v := a.(type) {
+	case *XML:
+		if v.BOM {
+			s.print("\uFEFF")
+		}
+		if v.Prolog != nil {
+			s.node(v.Prolog)
+		}
+		if v.Element != nil {
+			s.node(v.Element)
+		}
+		for _, m := range v.Misc {
+			s.node(m)
+		}
+	case *Prolog:
+		if v.XMLDecl != nil {
+			s.node(v.XMLDecl)
+		}
+		for _, m := range v.Misc1 {
+			s.node(m)
+		}
+		if v.DOCType != nil {
+			s.node(v.DOCType)
+		}
+		for _, m := range v.Misc2 {
+			s.node(m)
+		}
+	case *XMLDecl:
+		s.xmlDecl(v)
+	case *DOCType:
+		if len(v.Raw) > 0 {
+			s.print(v.Raw)
+		} else {
+			var b strings.Builder
+			NewFormatter(Writer(&b)).FormatDOCType(v, 0)
+			s.print(b.String())
+		}
+	case *Element:
+		s.element(v)
+	case *PI:
+		s.print("<?", v.Target)
+		if len(v.Space) > 0 {
+			s.print(v.Space)
+		} else if len(v.Instruction) > 0 {
+			s.print(" ")
+		}
+		s.print(v.Instruction, "?>")
+	case *CharData:
+		s.print(textEscaper.Replace(v.Value))
+	case Terminal:
+		s.print(v.ToString())
+	case string:
+		s.print(v)
+	}
+}
+
+func (s *serializer) xmlDecl(x *XMLDecl) {
+	s.print("<?xml")
+	s.pair(x.VersionTrivia, "version", x.Version)
+	if len(x.Encoding) > 0 {
+		s.pair(x.EncodingTrivia, "encoding", x.Encoding)
+	}
+	if x.StandaloneTrivia != nil || x.Standalone {
+		std := "no"
+		if x.Standalone {
+			std = "yes"
+		}
+		s.pair(x.StandaloneTrivia, "standalone", std)
+	}
+	s.print(x.Space, "?>")
+}
+
+func (s *serializer) pair(t *Trivia, name, value string) {
+	var tr Trivia
+	if t != nil {
+		tr = *t
+	}
+	tr = tr.orDefault()
+	quote := string(tr.Quote)
+	s.print(tr.Space, name, tr.Eq, quote, value, quote)
+}
+
+func (s *serializer) element(e *Element) {
+	s.print("<", e.Name)
+	for _, attr := range e.Attrs {
+		tr := attr.Trivia.orDefault()
+		quote := string(tr.Quote)
+		s.print(tr.Space, attr.Name, tr.Eq, quote)
+		for _, v := range attr.AttValue {
+			switch v := v.(type) {
+			case string:
+				s.print(escapeAttr(v, tr.Quote))
+			case Terminal:
+				s.print(v.ToString())
+			}
+		}
+		s.print(quote)
+	}
+	s.print(e.STagSpace)
+
+	if e.IsEmptyTag {
+		s.print("/>")
+		return
+	}
+	s.print(">")
+	for _, c := range e.Contents {
+		s.node(c)
+	}
+	s.print("</", e.Name, e.ETagSpace, ">")
+}
+
+// orDefault fills the fields of t that were not recorded.
+func (t Trivia) orDefault() Trivia {
+	if len(t.Space) == 0 {
+		t.Space = " "
+	}
+	if len(t.Eq) == 0 {
+		t.Eq = "="
+	}
+	if t.Quote == 0 {
+		t.Quote = '"'
+	}
+	return t
+}
+
+var (
+	// textEscaper escapes the characters that cannot appear literally in
+	// character data. Text read from a document never has them, so
+	// unmodified text is written as it was read.
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", "]]>", "]]&gt;")
+	attrEscaper = map[rune]*strings.Replacer{
+		'"':  strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;"),
+		'\'': strings.NewReplacer("&", "&amp;", "<", "&lt;", "'", "&apos;"),
+	}
+)
+
+// escapeAttr escapes the characters of str that cannot appear literally
+// in an attribute value delimited by quote.
+func escapeAttr(str string, quote rune) string {
+	return attrEscaper[quote].Replace(str)
+}
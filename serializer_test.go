@@ -0,0 +1,158 @@
+package xml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSerialize_lossless(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{
+			name: "document",
+			source: `<?xml version='1.0'  encoding="UTF-8" ?>
+<!-- config -->
+<!DOCTYPE config [
+  <!ELEMENT config ANY>
+  <!ATTLIST config  name CDATA #IMPLIED>
+]>
+<config name = 'a "b"'   enabled="true" >
+	<item  key="x"/>
+	<item key='y' ></item >
+	<text xml:space="default">  a &amp; b &#65; <![CDATA[<c>]]> <?pi   data ?></text>
+</config>
+<!-- end -->
+`,
+		},
+		{
+			name:   "standalone",
+			source: `<?xml version="1.0" standalone="no"?><a/>`,
+		},
+		{
+			name:   "no declaration",
+			source: "\n\n<a>\r\n\t<b\r\n\t\tc=\"d\"\r\n\t/>\r\n</a>\r\n",
+		},
+		{
+			name:   "byte order mark",
+			source: "\uFEFF<?xml version=\"1.0\"?>\n<a/>",
+		},
+		{
+			name:   "PI without instruction",
+			source: `<?pi ?><a><?pi?></a>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := Parse(tt.source, Lossless())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b strings.Builder
+			if err := Serialize(&b, x); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.source {
+				t.Errorf("Serialize() = %q, want %q", got, tt.source)
+			}
+		})
+	}
+}
+
+func TestSerialize_edit(t *testing.T) {
+	source := `<?xml version='1.0'?>
+<config  a='1' >
+	<item   key = "x" />
+</config>
+`
+	x, err := Parse(source, Lossless())
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.Element.Attrs[0].AttValue = AttValue{"it's"}
+	x.Element.Attrs = append(x.Element.Attrs, &Attribute{Name: "b", AttValue: AttValue{"2"}})
+	x.Element.Contents = append(x.Element.Contents, &Element{Name: "new", IsEmptyTag: true}, &CharData{Value: "\n"})
+	x.Prolog.XMLDecl.Standalone = true
+
+	want := `<?xml version='1.0' standalone="yes"?>
+<config  a='it&apos;s' b="2" >
+	<item   key = "x" />
+<new/>
+</config>
+`
+	var b strings.Builder
+	if err := Serialize(&b, x); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("Serialize() = %q, want %q", got, want)
+	}
+}
+
+func TestSerialize(t *testing.T) {
+	x, err := Parse(`<?xml version='1.0'?> <a  b='c'> <?pi   x?> <d /></a>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0"?><a b="c"><?pi x?><d/></a>`
+	var b strings.Builder
+	if err := Serialize(&b, x); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("Serialize() = %q, want %q", got, want)
+	}
+}
+
+func TestSerialize_expanded(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		opts   []ParseOption
+		want   string
+	}{
+		{
+			name:   "text",
+			source: `<a>&lt;b&gt; &amp; ]]&gt;</a>`,
+			opts:   []ParseOption{ExpandEntities()},
+			want:   `<a>&lt;b> &amp; ]]&gt;</a>`,
+		},
+		{
+			name:   "attribute value",
+			source: `<a b='&lt;&quot;&apos;&amp;'/>`,
+			opts:   []ParseOption{ExpandEntities(), Lossless()},
+			want:   `<a b='&lt;"&apos;&amp;'/>`,
+		},
+		{
+			name:   "default attribute value",
+			source: `<!DOCTYPE a [<!ATTLIST a b CDATA "&#38;&#60;">]><a/>`,
+			opts:   []ParseOption{ApplyDefaults(), Lossless()},
+			want:   `<!DOCTYPE a [<!ATTLIST a b CDATA "&#38;&#60;">]><a b="&amp;&lt;"/>`,
+		},
+		{
+			name:   "entity",
+			source: `<!DOCTYPE a [<!ENTITY e "&amp;&lt;">]><a>&e;</a>`,
+			opts:   []ParseOption{ExpandEntities(), Lossless()},
+			want:   `<!DOCTYPE a [<!ENTITY e "&amp;&lt;">]><a>&amp;&lt;</a>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := Parse(tt.source, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b strings.Builder
+			if err := Serialize(&b, x); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("Serialize() = %q, want %q", got, tt.want)
+			}
+			if _, err := Parse(b.String()); err != nil {
+				t.Errorf("Serialize() wrote malformed XML: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package xml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rune returns the character c refers to.
+func (c CharRef) Rune() (rune, error) {
+	base := 10
+	if c.Prefix == "&#x" {
+		base = 16
+	}
+	n, err := strconv.ParseUint(c.Value, base, 32)
+	// WFC: Legal Character
+	if err != nil || !isChar(rune(n)) {
+		return 0, fmt.Errorf("%s does not refer to a legal character", c.ToString())
+	}
+	return rune(n), nil
+}
+
+// Text returns the value with predefined entities and character references
+// replaced. It fails on references to other entities.
+func (a AttValue) Text() (string, error) {
+	return decodeText(a)
+}
+
+// Text returns the literal value with predefined entities and character
+// references replaced. It fails on references to other entities and on
+// parameter-entity references.
+func (e EntityValue) Text() (string, error) {
+	return decodeText(e)
+}
+
+// Text returns the character data of e and its descendants, with CDATA
+// sections, predefined entities and character references decoded.
+// It fails on references to other entities.
+func (e Element) Text() (string, error) {
+	var b strings.Builder
+	if err := e.writeText(&b); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func (e Element) writeText(b *strings.Builder) error {
+	for _, c := range e.Contents {
+		switch v := c.(type) {
+		case *Element:
+			if err := v.writeText(b); err != nil {
+				return err
+			}
+		case *CharData:
+			b.WriteString(v.Value)
+		case *CData:
+			b.WriteString(v.Value)
+		case *Comment, *PI:
+		default:
+			s, err := decodeRef(v)
+			if err != nil {
+				return err
+			}
+			b.WriteString(s)
+		}
+	}
+	return nil
+}
+
+func decodeText(v []interface{}) (string, error) {
+	var b strings.Builder
+	for _, c := range v {
+		s, err := decodeRef(c)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(s)
+	}
+	return b.String(), nil
+}
+
+// decodeRef returns the text of a string, a character reference or
+// a reference to a predefined entity.
+func decodeRef(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case *CharRef:
+		r, err := v.Rune()
+		if err != nil {
+			return "", err
+		}
+		return string(r), nil
+	case *EntityRef:
+		if s, ok := predefinedEntities[v.Name]; ok {
+			return s, nil
+		}
+		return "", fmt.Errorf("reference to entity %q is not resolved", v.Name)
+	case *PERef:
+		return "", fmt.Errorf("reference to parameter entity %q is not resolved", v.Name)
+	default:
+		return "", fmt.Errorf("unexpected %T", v)
+	}
+}
@@ -0,0 +1,157 @@
+package xml
+
+import "testing"
+
+func TestCharRef_Rune(t *testing.T) {
+	tests := []struct {
+		ref     CharRef
+		want    rune
+		wantErr bool
+	}{
+		{ref: CharRef{Prefix: "&#", Value: "65"}, want: 'A'},
+		{ref: CharRef{Prefix: "&#x", Value: "3042"}, want: 'あ'},
+		{ref: CharRef{Prefix: "&#x", Value: "1F600"}, want: '😀'},
+		{ref: CharRef{Prefix: "&#", Value: "0"}, wantErr: true},
+		{ref: CharRef{Prefix: "&#x", Value: "D800"}, wantErr: true},
+		{ref: CharRef{Prefix: "&#x", Value: "FFFE"}, wantErr: true},
+		{ref: CharRef{Prefix: "&#x", Value: "110000"}, wantErr: true},
+		{ref: CharRef{Prefix: "&#", Value: "99999999999"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref.ToString(), func(t *testing.T) {
+			got, err := tt.ref.Rune()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CharRef.Rune() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("CharRef.Rune() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAttValue_Text(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   AttValue
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "plain",
+			value: AttValue{"abc"},
+			want:  "abc",
+		},
+		{
+			name: "references",
+			value: AttValue{
+				"a",
+				&EntityRef{Name: "lt"},
+				&CharRef{Prefix: "&#x", Value: "41"},
+				&EntityRef{Name: "quot"},
+			},
+			want: `a<A"`,
+		},
+		{
+			name:    "undeclared entity",
+			value:   AttValue{&EntityRef{Name: "foo"}},
+			wantErr: true,
+		},
+		{
+			name:    "illegal character",
+			value:   AttValue{&CharRef{Prefix: "&#", Value: "1"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.value.Text()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AttValue.Text() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("AttValue.Text() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEntityValue_Text(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   EntityValue
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "references",
+			value: EntityValue{"x", &EntityRef{Name: "amp"}, &CharRef{Prefix: "&#", Value: "38"}},
+			want:  "x&&",
+		},
+		{
+			name:    "parameter entity",
+			value:   EntityValue{&PERef{Name: "pe"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.value.Text()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("EntityValue.Text() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("EntityValue.Text() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestElement_Text(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "nested",
+			source: `<a>one <b>two</b><c/> three</a>`,
+			want:   "one two three",
+		},
+		{
+			name:   "references and CDATA",
+			source: `<a>&lt;&#x41;<![CDATA[<&>]]></a>`,
+			want:   "<A<&>",
+		},
+		{
+			name:   "comments and PIs skipped",
+			source: `<a>x<!-- c --><?pi y?>z</a>`,
+			want:   "xz",
+		},
+		{
+			name:    "unresolved entity",
+			source:  `<!DOCTYPE a [<!ENTITY e "v">]><a>&e;</a>`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := Parse(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := x.Element.Text()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Element.Text() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Element.Text() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
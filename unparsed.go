@@ -0,0 +1,108 @@
+package xml
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UnparsedEntity is an unparsed entity named by an attribute of type
+// ENTITY or ENTITIES.
+type UnparsedEntity struct {
+	*Entity
+	// declaration of the notation Entity.NData, nil if it is not declared
+	Notation *Notation
+}
+
+// UnparsedEntities returns the unparsed entities named by the attribute
+// attr of e, which the DTD of x must declare as ENTITY or ENTITIES. The
+// default value of attr is used when e omits it.
+func (x *XML) UnparsedEntities(e *Element, attr string) ([]*UnparsedEntity, error) {
+	if x.Prolog == nil || x.Prolog.DOCType == nil {
+		return nil, fmt.Errorf("document has no document type declaration")
+	}
+	v := newValidator(x.Prolog.DOCType)
+	def := v.attDefs.get(e.Name, attr)
+	if def == nil || def.Type != AttTokenENTITY && def.Type != AttTokenENTITIES {
+		return nil, fmt.Errorf("attribute %q of element %q is not declared as ENTITY or ENTITIES", attr, e.Name)
+	}
+	var value AttValue
+	for _, at := range e.Attrs {
+		if at.Name == attr {
+			value = at.AttValue
+		}
+	}
+	if value == nil {
+		if def.Decl == nil || def.Decl.Type != DefaultDeclTypeFixed && def.Decl.Type != DefaultDeclTypeValue {
+			return nil, fmt.Errorf("element %q has no attribute %q", e.Name, attr)
+		}
+		value = def.Decl.AttValue
+	}
+	text, err := normalizeAttValue(value, true).Text()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{text}
+	if def.Type == AttTokenENTITIES {
+		names = strings.Split(text, " ")
+	}
+	var res []*UnparsedEntity
+	for _, name := range names {
+		if !isName(name) {
+			return nil, fmt.Errorf("value %q of %s attribute %q is not a name", name, def.Type.ToString(), attr)
+		}
+		ent, ok := v.entities[name]
+		if !ok || len(ent.NData) == 0 {
+			return nil, fmt.Errorf("%q is not the name of an unparsed entity", name)
+		}
+		res = append(res, &UnparsedEntity{
+			Entity:   ent,
+			Notation: v.notations[ent.NData],
+		})
+	}
+	return res, nil
+}
+
+// checkNotations reports references to notations that are not declared
+// in unparsed entities and NOTATION attribute types.
+func (v *validator) checkNotations() {
+	for _, ent := range v.entities {
+		// VC: Notation Declared
+		if len(ent.NData) > 0 && v.notations[ent.NData] == nil {
+			v.report("Notation Declared", ent.Start, "notation %q of entity %q is not declared", ent.NData, ent.Name)
+		}
+	}
+	for _, defs := range v.attDefs.list {
+		for _, def := range defs {
+			t, ok := def.Type.(*NotationType)
+			if !ok {
+				continue
+			}
+			// VC: Notation Attributes
+			for _, name := range t.Names {
+				if v.notations[name] == nil {
+					v.report("Notation Attributes", t.Start, "notation %q of attribute %q is not declared", name, def.Name)
+				}
+			}
+		}
+	}
+}
+
+// entityNames checks that value of the ENTITY or ENTITIES attribute a
+// names unparsed entities.
+func (v *validator) entityNames(a *Attribute, def *AttDef, value string) {
+	// VC: Entity Name
+	names := []string{value}
+	if def.Type == AttTokenENTITIES {
+		names = strings.Split(value, " ")
+	}
+	for _, name := range names {
+		if !isName(name) {
+			v.report("Entity Name", a.Start, "value %q of %s attribute %q is not a name", name, def.Type.ToString(), a.Name)
+			return
+		}
+		if ent, ok := v.entities[name]; !ok || len(ent.NData) == 0 {
+			v.report("Entity Name", a.Start, "value %q of attribute %q is not the name of an unparsed entity", name, a.Name)
+		}
+	}
+}
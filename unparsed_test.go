@@ -0,0 +1,90 @@
+package xml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestXML_UnparsedEntities(t *testing.T) {
+	x, err := Parse(`<!DOCTYPE a [
+<!ATTLIST a pic ENTITY #IMPLIED pics ENTITIES #IMPLIED title CDATA #IMPLIED one ENTITY #IMPLIED>
+<!ATTLIST a dflt ENTITIES "logo">
+<!NOTATION gif SYSTEM "image/gif">
+<!ENTITY logo SYSTEM "logo.gif" NDATA gif>
+<!ENTITY icon PUBLIC "-//icon" "icon.png" NDATA png>
+<!ENTITY text "text">
+]><a pic="logo" pics=" icon logo " title="t" one="logo icon"><a pic="text"/></a>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child := x.Element.Contents[0].(*Element)
+	tests := []struct {
+		name    string
+		e       *Element
+		attr    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "ENTITY",
+			e:    x.Element,
+			attr: "pic",
+			want: []string{"logo logo.gif gif"},
+		},
+		{
+			name: "ENTITIES",
+			e:    x.Element,
+			attr: "pics",
+			want: []string{"icon icon.png <nil>", "logo logo.gif gif"},
+		},
+		{
+			name:    "ENTITY with several names",
+			e:       x.Element,
+			attr:    "one",
+			wantErr: true,
+		},
+		{
+			name: "default",
+			e:    child,
+			attr: "dflt",
+			want: []string{"logo logo.gif gif"},
+		},
+		{
+			name:    "not ENTITY",
+			e:       x.Element,
+			attr:    "title",
+			wantErr: true,
+		},
+		{
+			name:    "not specified",
+			e:       child,
+			attr:    "pics",
+			wantErr: true,
+		},
+		{
+			name:    "parsed entity",
+			e:       child,
+			attr:    "pic",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ents, err := x.UnparsedEntities(tt.e, tt.attr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnparsedEntities() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, ent := range ents {
+				notation := "<nil>"
+				if ent.Notation != nil {
+					notation = ent.Notation.Name
+				}
+				got = append(got, ent.Name+" "+ent.ExtID.System+" "+notation)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UnparsedEntities() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package xml
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Validate checks x against the declarations of its DTD, in DOCType.Markups
+// and DOCType.ExtSubset, and returns every violation of a validity
+// constraint it finds in document order, including content models that
+// are not deterministic. Content and attribute values
+// holding references to entities that were not expanded are not checked.
+func Validate(x *XML) []*ValidityError {
+	if x.Prolog == nil || x.Prolog.DOCType == nil {
+		return []*ValidityError{
+			newValidityErr("Document Type Declaration", fmt.Errorf("document has no document type declaration"), Pos{Line: 1, Col: 1}),
+		}
+	}
+	v := newValidator(x.Prolog.DOCType)
+	if x.Element != nil {
+		// VC: Root Element Type
+		if x.Element.Name != x.Prolog.DOCType.Name {
+			v.report("Root Element Type", x.Element.STag.Start, "root element %q does not match the document type name %q", x.Element.Name, x.Prolog.DOCType.Name)
+		}
+		v.element(x.Element)
+		v.checkIDRefs()
+	}
+	sort.SliceStable(v.errs, func(i, j int) bool {
+		return v.errs[i].Pos.Offset < v.errs[j].Pos.Offset
+	})
+	return v.errs
+}
+
+type validator struct {
+	elements map[string]*ElementDecl
+	// attribute definitions of the elements
+	attDefs attDefs
+	models  map[*ElementDecl]*ContentModel
+	// general entities and notations by name
+	entities  map[string]*Entity
+	notations map[string]*Notation
+	// elements by the values of their ID attributes
+	ids  map[string]*Element
+	refs []idRef
+	errs []*ValidityError
+}
+
+func newValidator(d *DOCType) *validator {
+	v := &validator{
+		elements:  map[string]*ElementDecl{},
+		attDefs:   newAttDefs(),
+		models:    map[*ElementDecl]*ContentModel{},
+		entities:  map[string]*Entity{},
+		notations: map[string]*Notation{},
+		ids:       map[string]*Element{},
+	}
+	v.declare(d.Markups)
+	v.declare(d.ExtSubset)
+	v.checkNotations()
+	return v
+}
+
+// declare records the declarations in markups and in their INCLUDE sections.
+func (v *validator) declare(markups []Markup) {
+	for _, m := range markups {
+		switch m := m.(type) {
+		case *ElementDecl:
+			// VC: Unique Element Type Declaration
+			if _, ok := v.elements[m.Name]; ok {
+				v.report("Unique Element Type Declaration", m.Start, "element type %q is declared more than once", m.Name)
+				continue
+			}
+			v.elements[m.Name] = m
+			if err := ambiguousContent(m); err != nil {
+				v.errs = append(v.errs, newValidityErr("Deterministic Content Models", err, err.Second))
+			}
+		case *Attlist:
+			for _, def := range m.Defs {
+				// the first definition of an attribute is binding
+				if v.attDefs.get(m.Name, def.Name) != nil {
+					continue
+				}
+				if def.Type == AttTokenID {
+					v.declareID(m.Name, def)
+				}
+				v.attDefs.add(m.Name, def)
+			}
+		case *Entity:
+			// the first declaration of an entity is binding
+			if _, ok := v.entities[m.Name]; !ok && m.Type == EntityTypeGE {
+				v.entities[m.Name] = m
+			}
+		case *Notation:
+			// VC: Unique Notation Name
+			if _, ok := v.notations[m.Name]; ok {
+				v.report("Unique Notation Name", m.Start, "notation %q is declared more than once", m.Name)
+				continue
+			}
+			v.notations[m.Name] = m
+		case *CondSect:
+			if m.Keyword == "INCLUDE" {
+				v.declare(m.Markups)
+			}
+		}
+	}
+}
+
+func (v *validator) report(constraint string, pos Pos, format string, a ...interface{}) {
+	v.errs = append(v.errs, newValidityErr(constraint, fmt.Errorf(format, a...), pos))
+}
+
+func (v *validator) element(e *Element) {
+	// VC: Element Valid
+	decl, ok := v.elements[e.Name]
+	if !ok {
+		v.report("Element Valid", e.STag.Start, "element type %q is not declared", e.Name)
+	}
+	v.attributes(e)
+	if ok {
+		v.content(e, decl)
+	}
+	for _, c := range e.Contents {
+		if c, ok := c.(*Element); ok {
+			v.element(c)
+		}
+	}
+}
+
+// end returns the position where the content of e ends.
+func end(e *Element) Pos {
+	if e.IsEmptyTag {
+		return e.STag.Start
+	}
+	return e.ETag.Start
+}
+
+func (v *validator) content(e *Element, decl *ElementDecl) {
+	switch decl.ContentSpec.(type) {
+	case *EMPTY:
+		if len(e.Contents) > 0 {
+			v.report("Element Valid", e.STag.Start, "element %q is declared EMPTY but has content", e.Name)
+		}
+	case *Mixed:
+		m := v.model(decl)
+		for _, c := range e.Contents {
+			c, ok := c.(*Element)
+			if !ok {
+				continue
+			}
+			if _, ok := m.Step(m.Start(), c.Name); !ok {
+				v.report("Element Valid", c.STag.Start, "element %q is not allowed in the mixed content of %q", c.Name, e.Name)
+			}
+		}
+	case *Children:
+		m := v.model(decl)
+		s := m.Start()
+		for _, c := range e.Contents {
+			switch c := c.(type) {
+			case *Element:
+				next, ok := m.Step(s, c.Name)
+				if !ok {
+					v.report("Element Valid", c.STag.Start, "element %q is not allowed here in %q; expected %s", c.Name, e.Name, expectation(m, s))
+					return
+				}
+				s = next
+			case *CharData:
+				if !isOnlySpaces(c.Value) {
+					v.reportCharData(e, c.Start)
+					return
+				}
+			case *CData:
+				v.reportCharData(e, c.Start)
+				return
+			case *CharRef:
+				v.reportCharData(e, c.Start)
+				return
+			case *EntityRef:
+				// the content of the entity is unknown
+				return
+			}
+		}
+		if !m.Accepts(s) {
+			v.report("Element Valid", end(e), "content of %q is incomplete; expected %s", e.Name, expectation(m, s))
+		}
+	}
+}
+
+// model returns the compiled content specification of decl.
+func (v *validator) model(decl *ElementDecl) *ContentModel {
+	m, ok := v.models[decl]
+	if !ok {
+		m = CompileContentSpec(decl.ContentSpec)
+		v.models[decl] = m
+	}
+	return m
+}
+
+func (v *validator) reportCharData(e *Element, pos Pos) {
+	v.report("Element Valid", pos, "character data is not allowed in the element content of %q", e.Name)
+}
+
+// expectation describes the elements that may come in state s of m.
+func expectation(m *ContentModel, s ContentState) string {
+	names := m.Allowed(s)
+	if m.Accepts(s) {
+		names = append(names, "end of content")
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return "one of " + strings.Join(names, ", ")
+}
+
+func (v *validator) attributes(e *Element) {
+	specified := make(map[string]bool, len(e.Attrs))
+	for _, a := range e.Attrs {
+		specified[a.Name] = true
+		// VC: Attribute Value Type
+		def := v.attDefs.get(e.Name, a.Name)
+		if def == nil {
+			v.report("Attribute Value Type", a.Start, "attribute %q of element %q is not declared", a.Name, e.Name)
+			continue
+		}
+		value, err := normalizeAttValue(a.AttValue, isTokenized(def.Type)).Text()
+		if err != nil {
+			continue
+		}
+
+		// VC: Fixed Attribute Default
+		if def.Decl != nil && def.Decl.Type == DefaultDeclTypeFixed {
+			fixed, err := normalizeAttValue(def.Decl.AttValue, isTokenized(def.Type)).Text()
+			if err == nil && value != fixed {
+				v.report("Fixed Attribute Default", a.Start, "attribute %q of element %q must have the fixed value %q", a.Name, e.Name, fixed)
+			}
+		}
+		// VC: Enumeration
+		if enum, ok := def.Type.(*Enum); ok && !contains(enum.Cases, value) {
+			v.report("Enumeration", a.Start, "value %q of attribute %q is not one of %s", value, a.Name, enum.ToString())
+		}
+		// VC: Notation Attributes
+		if n, ok := def.Type.(*NotationType); ok && !contains(n.Names, value) {
+			v.report("Notation Attributes", a.Start, "value %q of attribute %q is not one of %s", value, a.Name, n.ToString())
+		}
+		switch def.Type {
+		case AttTokenENTITY, AttTokenENTITIES:
+			v.entityNames(a, def, value)
+		case AttTokenID:
+			v.id(e, a, value)
+		case AttTokenIDREF, AttTokenIDREFS:
+			v.idRefs(e, a, def, value)
+		}
+	}
+
+	// VC: Required Attribute
+	for _, def := range v.attDefs.of(e.Name) {
+		if def.Decl == nil || def.Decl.Type != DefaultDeclTypeRequired {
+			continue
+		}
+		if !specified[def.Name] {
+			v.report("Required Attribute", e.STag.Start, "element %q has no required attribute %q", e.Name, def.Name)
+		}
+	}
+}
+
+func contains(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
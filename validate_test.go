@@ -0,0 +1,216 @@
+package xml
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	const dtd = `<!DOCTYPE doc [
+<!ELEMENT doc (head, (p | list)*, foot?)>
+<!ELEMENT head EMPTY>
+<!ELEMENT p (#PCDATA | b)*>
+<!ELEMENT b (#PCDATA)>
+<!ELEMENT list (item+)>
+<!ELEMENT item ANY>
+<!ELEMENT foot EMPTY>
+<!ATTLIST doc
+	version CDATA #FIXED "1.0"
+	lang NMTOKEN #REQUIRED
+	status (draft | final) "draft">
+<!ATTLIST item n NMTOKEN #FIXED "1">
+<!ENTITY e "<b/>">
+]>
+`
+	tests := []struct {
+		name   string
+		source string
+		opts   []ParseOption
+		want   []string
+	}{
+		{
+			name:   "valid",
+			source: dtd + `<doc lang="en" status="final"><head/><p>x <b>y</b></p><list><item n=" 1 "><p/></item></list><foot></foot></doc>`,
+		},
+		{
+			name:   "no DOCTYPE",
+			source: `<doc/>`,
+			want:   []string{"1:1 Document Type Declaration"},
+		},
+		{
+			name:   "root element type",
+			source: `<!DOCTYPE doc [<!ELEMENT p EMPTY>]><p/>`,
+			want:   []string{"1:36 Root Element Type"},
+		},
+		{
+			name:   "undeclared element",
+			source: dtd + `<doc lang="en"><head/><p><i/></p><x/></doc>`,
+			want: []string{
+				"16:26 Element Valid",
+				"16:26 Element Valid",
+				"16:34 Element Valid",
+				"16:34 Element Valid",
+			},
+		},
+		{
+			name:   "content model mismatch",
+			source: dtd + `<doc lang="en"><p/><list></list></doc>`,
+			want: []string{
+				"16:16 Element Valid",
+				"16:26 Element Valid",
+			},
+		},
+		{
+			name:   "missing element at end",
+			source: dtd + `<doc lang="en"><head/><foot/><p/></doc>`,
+			want:   []string{"16:30 Element Valid"},
+		},
+		{
+			name:   "character data in element content",
+			source: dtd + `<doc lang="en"><head/>text</doc>`,
+			want:   []string{"16:23 Element Valid"},
+		},
+		{
+			name:   "EMPTY with content",
+			source: dtd + `<doc lang="en"><head><!-- --></head></doc>`,
+			want:   []string{"16:16 Element Valid"},
+		},
+		{
+			name:   "attributes",
+			source: dtd + `<doc version="2.0" status="other" x="y"><head/></doc>`,
+			want: []string{
+				"16:1 Required Attribute",
+				"16:6 Fixed Attribute Default",
+				"16:20 Enumeration",
+				"16:35 Attribute Value Type",
+			},
+		},
+		{
+			name:   "unexpanded entity not checked",
+			source: dtd + `<doc lang="en"><head/><p>&e;</p><list><item>&e;</item></list>&e;</doc>`,
+		},
+		{
+			name:   "expanded entity checked",
+			source: dtd + `<doc lang="en"><head/><list>&e;</list><p x="1"/></doc>`,
+			opts:   []ParseOption{ExpandEntities()},
+			want:   []string{"16:29 Element Valid", "16:42 Attribute Value Type"},
+		},
+		{
+			name: "not deterministic",
+			source: `<!DOCTYPE a [
+<!ELEMENT a ((b, c) | (b, d))>
+<!ELEMENT b EMPTY>
+<!ELEMENT c EMPTY>
+<!ELEMENT d EMPTY>
+]><a><b/><d/></a>`,
+			want: []string{"2:24 Deterministic Content Models"},
+		},
+		{
+			name: "duplicate element type",
+			source: `<!DOCTYPE a [
+<!ELEMENT a EMPTY>
+<!ELEMENT a ANY>
+]><a/>`,
+			want: []string{"3:1 Unique Element Type Declaration"},
+		},
+		{
+			name: "IDs",
+			source: `<!DOCTYPE a [
+<!ELEMENT a ANY>
+<!ATTLIST a id ID #IMPLIED ref IDREF #IMPLIED refs IDREFS #IMPLIED>
+]><a id="x1"><a id=" x2 " refs=" x1  x2 "/><a id="x1" ref="x3"/><a id="1" refs="x2 2"/></a>`,
+			want: []string{
+				"4:47 ID",
+				"4:55 IDREF",
+				"4:68 ID",
+				"4:75 IDREF",
+			},
+		},
+		{
+			name: "ID declarations",
+			source: `<!DOCTYPE a [
+<!ELEMENT a EMPTY>
+<!ATTLIST a id ID #IMPLIED>
+<!ATTLIST a key ID "k" ref IDREF #IMPLIED>
+]><a ref="k"/>`,
+			want: []string{
+				"4:13 One ID per Element Type",
+				"4:13 ID Attribute Default",
+				"5:6 IDREF",
+			},
+		},
+		{
+			name: "unparsed entities and notations",
+			source: `<!DOCTYPE a [
+<!ELEMENT a ANY>
+<!ATTLIST a pic ENTITY #IMPLIED pics ENTITIES #IMPLIED fmt NOTATION (gif | svg) #IMPLIED>
+<!NOTATION gif SYSTEM "image/gif">
+<!NOTATION gif SYSTEM "image/gif">
+<!ENTITY logo SYSTEM "logo.gif" NDATA gif>
+<!ENTITY icon SYSTEM "icon.png" NDATA png>
+<!ENTITY text "text">
+]><a pic="logo" pics=" logo  icon " fmt="gif"><a pic="text" pics="1"/><a fmt="png"/></a>`,
+			want: []string{
+				"3:60 Notation Attributes",
+				"5:1 Unique Notation Name",
+				"7:1 Notation Declared",
+				"9:50 Entity Name",
+				"9:61 Entity Name",
+				"9:74 Notation Attributes",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := Parse(tt.source, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, err := range Validate(x) {
+				got = append(got, fmt.Sprintf("%d:%d %s", err.Pos.Line, err.Pos.Col, err.Constraint))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %v, want %v", Validate(x), tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate_ambiguousContent(t *testing.T) {
+	// the content is checked without building all 2^n states of the model
+	const n = 20
+	dtd := `<!DOCTYPE r [
+<!ELEMENT r ((a | b)*, a` + strings.Repeat(", (a | b)", n) + `)>
+<!ELEMENT a EMPTY>
+<!ELEMENT b EMPTY>
+]>`
+	tests := []struct {
+		content string
+		want    []string
+	}{
+		{
+			content: "<b/><a/>" + strings.Repeat("<b/>", n),
+			want:    []string{"2:24 Deterministic Content Models"},
+		},
+		{
+			content: "<a/>" + strings.Repeat("<b/>", n+1),
+			want:    []string{"2:24 Deterministic Content Models", "5:94 Element Valid"},
+		},
+	}
+	for _, tt := range tests {
+		x, err := Parse(dtd + "<r>" + tt.content + "</r>")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, err := range Validate(x) {
+			got = append(got, fmt.Sprintf("%d:%d %s", err.Pos.Line, err.Pos.Col, err.Constraint))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Validate() = %v, want %v", Validate(x), tt.want)
+		}
+	}
+}
@@ -1,14 +1,96 @@
 package xml
 
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
 func newParser(str string) *parser {
 	return &parser{
 		scanner: &scanner{
-			source: []rune(str),
-			cursor: 0,
+			source: []byte(str),
 		},
 	}
 }
 
-func Parse(str string) (*XML, error) {
-	return newParser(str).parse()
+func newScanner(r io.Reader) *scanner {
+	return &scanner{
+		reader: r,
+	}
+}
+
+func Parse(str string, opts ...ParseOption) (*XML, error) {
+	return ParseReader(strings.NewReader(str), opts...)
+}
+
+func ParseBytes(b []byte, opts ...ParseOption) (*XML, error) {
+	return ParseReader(bytes.NewReader(b), opts...)
+}
+
+// ParseReader parses a document read incrementally from r, releasing
+// the input of the content of elements as it is read.
+// The encoding of the input is detected from its byte order mark
+// or XML declaration. A read error other than io.EOF is returned as is.
+func ParseReader(r io.Reader, opts ...ParseOption) (*XML, error) {
+	p, err := newReaderParser(r, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x, err := p.parse()
+	if p.err != nil {
+		return nil, p.err
+	}
+	return x, err
+}
+
+// ParseDTD parses a DTD file, an external subset consisting of an optional
+// text declaration and markup declarations. References to parameter
+// entities are kept in DTD.Markups unless ExpandParameterEntities is given;
+// references within declarations can only be read with that option.
+func ParseDTD(r io.Reader, opts ...ParseOption) (*DTD, error) {
+	p, err := newReaderParser(r, opts...)
+	if err != nil {
+		return nil, err
+	}
+	d, err := p.parseExtSubset()
+	if p.err != nil {
+		return nil, p.err
+	}
+	return d, err
+}
+
+func newReaderParser(r io.Reader, opts ...ParseOption) (*parser, error) {
+	p := &parser{
+		expansionLimits: DefaultExpansionLimits,
+	}
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+	if p.maxSize > 0 {
+		r = &limitReader{
+			r: r,
+			n: p.maxSize,
+		}
+	}
+
+	r, bom, err := p.detectEncoding(r)
+	if err != nil {
+		return nil, err
+	}
+	p.bom = bom && p.lossless
+	p.scanner = newScanner(r)
+	if bom {
+		// offsets count the byte order mark that was read
+		p.scanner.base = uint(len(utf8BOM))
+		p.scanner.cursor.index = p.scanner.base
+	}
+	if p.expansionLimits != (ExpansionLimits{}) {
+		p.expansion = &expansion{
+			input: p.scanner,
+		}
+	}
+	return p, nil
 }
@@ -0,0 +1,349 @@
+package xml
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestParseReader(t *testing.T) {
+	want := &XML{
+		Prolog: &Prolog{
+			XMLDecl: &XMLDecl{
+				Version: "1.0",
+			},
+		},
+		Element: &Element{
+			Name: "root",
+			Attrs: Attributes{
+				{
+					Name:     "a",
+					AttValue: AttValue{"b"},
+				},
+			},
+			Contents: []interface{}{
+				&CharData{Value: "text"},
+			},
+		},
+	}
+	source := `<?xml version="1.0"?><root a="b">text</root>`
+
+	tests := []struct {
+		name    string
+		parse   func() (*XML, error)
+		want    *XML
+		wantErr bool
+	}{
+		{
+			name: "string",
+			parse: func() (*XML, error) {
+				return Parse(source)
+			},
+			want: want,
+		},
+		{
+			name: "bytes",
+			parse: func() (*XML, error) {
+				return ParseBytes([]byte(source))
+			},
+			want: want,
+		},
+		{
+			name: "one byte at a time",
+			parse: func() (*XML, error) {
+				return ParseReader(iotest.OneByteReader(strings.NewReader(source)))
+			},
+			want: want,
+		},
+		{
+			name: "read error",
+			parse: func() (*XML, error) {
+				return ParseReader(iotest.TimeoutReader(iotest.OneByteReader(strings.NewReader(source))))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.parse()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseReader() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr && !errors.Is(err, iotest.ErrTimeout) {
+				t.Errorf("ParseReader() error = %v, want %v", err, iotest.ErrTimeout)
+			}
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
+				t.Errorf("ParseReader() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// charData returns the character data in e and its descendants in document order.
+func charData(e *Element) []string {
+	var res []string
+	for _, c := range e.Contents {
+		switch v := c.(type) {
+		case *CharData:
+			res = append(res, v.Value)
+		case *Element:
+			res = append(res, charData(v)...)
+		}
+	}
+	return res
+}
+
+func TestParse_whitespace(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		opts   []ParseOption
+		want   []string
+	}{
+		{
+			name:   "dropped by default",
+			source: `<p><b>a</b> <i>b</i></p>`,
+			want:   []string{"a", "b"},
+		},
+		{
+			name:   "PreserveWhitespace",
+			source: `<p><b>a</b> <i>b</i></p>`,
+			opts:   []ParseOption{PreserveWhitespace()},
+			want:   []string{"a", " ", "b"},
+		},
+		{
+			name:   "xml:space preserve",
+			source: `<p> <pre xml:space="preserve"> <b> </b></pre> </p>`,
+			want:   []string{" ", " "},
+		},
+		{
+			name:   "xml:space default",
+			source: `<pre xml:space="preserve"><p xml:space="default"> </p> </pre>`,
+			want:   []string{" "},
+		},
+		{
+			name:   "xml:space default with PreserveWhitespace",
+			source: `<pre xml:space="preserve"><p xml:space="default"> </p> </pre>`,
+			opts:   []ParseOption{PreserveWhitespace()},
+			want:   []string{" ", " "},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.source, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if texts := charData(got.Element); !reflect.DeepEqual(texts, tt.want) {
+				t.Errorf("CharData = %q, want %q", texts, tt.want)
+			}
+		})
+	}
+}
+
+// benchDocument returns a document of about size bytes made of records
+// with attributes, character data, references, CDATA sections and comments.
+func benchDocument(size int) []byte {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n<records>\n")
+	for i := 0; b.Len() < size; i++ {
+		b.WriteString(`	<record id="r` + strconv.Itoa(i) + `" lang="en">` + "\n")
+		b.WriteString("\t\t<title>Subjects available in Mechanical Engineering &amp; Physics</title>\n")
+		b.WriteString("\t\t<body><![CDATA[x < y && y > z]]> ünïcödé tëxt &#x263A;</body>\n")
+		b.WriteString("\t\t<!-- a comment -->\n")
+		b.WriteString("\t</record>\n")
+	}
+	b.WriteString("</records>\n")
+	return []byte(b.String())
+}
+
+// benchTextDocument returns a document whose root holds a single text node
+// and a single CDATA section of about size bytes each.
+func benchTextDocument(size int) []byte {
+	text := strings.Repeat("lorem ipsum dolor sit amet ", size/27)
+	return []byte("<root>" + text + "<![CDATA[" + text + "]]></root>")
+}
+
+func benchmarkParseBytes(b *testing.B, doc []byte) {
+	b.SetBytes(int64(len(doc)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseBytes(doc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseBytes_records(b *testing.B) {
+	benchmarkParseBytes(b, benchDocument(4<<20))
+}
+
+func BenchmarkParseBytes_text(b *testing.B) {
+	benchmarkParseBytes(b, benchTextDocument(2<<20))
+}
+
+func BenchmarkDecoder(b *testing.B) {
+	doc := benchDocument(4 << 20)
+	b.SetBytes(int64(len(doc)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		d := NewDecoder(bytes.NewReader(doc))
+		for d.Next() {
+		}
+		if err := d.Err(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestParseDTD(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		opts    []ParseOption
+		want    *DTD
+		wantErr bool
+	}{
+		{
+			name: "declarations",
+			source: `<?xml version="1.0" encoding="UTF-8"?>
+<!-- people -->
+<!ELEMENT people (person*)>
+<!ATTLIST person id ID #REQUIRED>
+%extra;
+<!NOTATION gif SYSTEM "image/gif">
+`,
+			want: &DTD{
+				TextDecl: &TextDecl{Version: "1.0", Encoding: "UTF-8"},
+				Markups: []Markup{
+					&Comment{Value: " people "},
+					&ElementDecl{Name: "people", ContentSpec: &Children{ChoiceSeq: &Choice{CPs: []CP{{Name: "person", Suffix: newRune('*')}}}}},
+					&Attlist{Name: "person", Defs: []*AttDef{{Name: "id", Type: AttTokenID, Decl: &DefaultDecl{Type: DefaultDeclTypeRequired}}}},
+					&PERef{Name: "extra"},
+					&Notation{Name: "gif", ExtID: ExternalID{Type: ExternalTypeSystem, System: "image/gif"}},
+				},
+			},
+		},
+		{
+			name:   "parameter entities expanded",
+			source: `<!ENTITY % model "(b)"><!ELEMENT a %model;>`,
+			opts:   []ParseOption{ExpandParameterEntities()},
+			want: &DTD{
+				Markups: []Markup{
+					&Entity{Name: "model", Type: EntityTypePE, Value: EntityValue{"(b)"}},
+					&ElementDecl{Name: "a", ContentSpec: &Children{ChoiceSeq: &Choice{CPs: []CP{{Name: "b"}}}}, PERefs: []*PERef{{Name: "model"}}},
+				},
+			},
+		},
+		{
+			name: "conditional sections",
+			source: `<!ENTITY % draft "INCLUDE">
+<!ENTITY % final "IGNORE">
+<![%draft;[
+  <![%final;[ <!ELEMENT a EMPTY> ]]>
+  <!ELEMENT a ANY>
+]]>`,
+			opts: []ParseOption{ExpandParameterEntities()},
+			want: &DTD{
+				Markups: []Markup{
+					&Entity{Name: "draft", Type: EntityTypePE, Value: EntityValue{"INCLUDE"}},
+					&Entity{Name: "final", Type: EntityTypePE, Value: EntityValue{"IGNORE"}},
+					&CondSect{
+						Keyword:    "INCLUDE",
+						KeywordRef: &PERef{Name: "draft"},
+						Markups: []Markup{
+							&CondSect{Keyword: "IGNORE", KeywordRef: &PERef{Name: "final"}, Ignored: " <!ELEMENT a EMPTY> "},
+							&ElementDecl{Name: "a", ContentSpec: &ANY{}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:    "conditional section keyword not INCLUDE or IGNORE",
+			source:  `<!ENTITY % draft "x"><![%draft;[]]>`,
+			opts:    []ParseOption{ExpandParameterEntities()},
+			wantErr: true,
+		},
+		{
+			name:    "parameter entity in declaration not expanded",
+			source:  `<!ENTITY % model "(b)"><!ELEMENT a %model;>`,
+			wantErr: true,
+		},
+		{
+			name:    "text declaration without encoding",
+			source:  `<?xml version="1.0"?><!ELEMENT a EMPTY>`,
+			wantErr: true,
+		},
+		{
+			name:    "not a declaration",
+			source:  `<!ELEMENT a EMPTY><a/>`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDTD(strings.NewReader(tt.source), tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDTD() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(withoutSpans(got), tt.want) {
+				t.Errorf("ParseDTD() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDTD_expansionLimits(t *testing.T) {
+	// %lol9; expands to 10^9 "lol"s
+	src := `<!ENTITY % lol0 "lol">`
+	for i := 1; i < 10; i++ {
+		src += `<!ENTITY % lol` + strconv.Itoa(i) + ` "` + strings.Repeat("%lol"+strconv.Itoa(i-1)+";", 10) + `">`
+	}
+	src += `<!ELEMENT a %lol9;>`
+	_, err := ParseDTD(strings.NewReader(src), ExpandParameterEntities())
+	if !errors.Is(err, ErrExpansionLimit) {
+		t.Errorf("ParseDTD() error = %v, want %v", err, ErrExpansionLimit)
+	}
+}
+
+func TestParseDTD_PERefInDeclaration(t *testing.T) {
+	_, err := ParseDTD(strings.NewReader(`<!ENTITY % inline "b | i">
+<!ELEMENT p (#PCDATA | %inline;)*>`))
+	want := `error while parsing DTD at line 2 column 24: parameter entity "inline" within a markup declaration is only read with ExpandParameterEntities`
+	if err == nil || err.Error() != want {
+		t.Errorf("ParseDTD() error = %v, want %s", err, want)
+	}
+}
+
+func TestParseReader_boundedBuffer(t *testing.T) {
+	// about 4 MB
+	r := &repeatReader{
+		head: `<?xml version="1.0"?><root><list>`,
+		body: `<item id="1">some text &amp; more<b/></item>`,
+		tail: `</list></root>`,
+		n:    100000,
+	}
+	p, err := newReaderParser(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err := p.parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(x.Element.Contents[0].(*Element).Contents); n != 100000 {
+		t.Errorf("read %d elements, want %d", n, 100000)
+	}
+	if c := cap(p.source); c > 4*readSize {
+		t.Errorf("source grew to %d bytes", c)
+	}
+}